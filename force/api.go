@@ -1,7 +1,10 @@
 package force
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"sync"
 )
 
 type ForceApi struct {
@@ -11,9 +14,21 @@ type ForceApi struct {
 	apiSObjects            map[string]*SObjectMetaData
 	apiSObjectDescriptions map[string]*SObjectDescription
 	apiMaxBatchSize        int64
+	log                    *forceLogger
 	logger                 ForceApiLogger
 	logPrefix              string
 	stream                 *StreamsForce
+	streamMu               sync.Mutex
+	httpClient             *http.Client
+	userAgent              string
+	retryPolicy            *RetryPolicy
+	usage                  *usageTracker
+	limiter                *rateLimiter
+	gzip                   bool
+	gzipMinSize            int
+	onStreamError          func(err error)
+	replayStore            ReplayStore
+	streamWorkers          *StreamingWorkers
 }
 
 type RefreshTokenResponse struct {
@@ -157,17 +172,17 @@ type ChildRelationship struct {
 	RelationshipName    string `json:"relationshipName"`
 }
 
-func (forceApi *ForceApi) getApiResources() error {
+func (forceApi *ForceApi) getApiResources(ctx context.Context) error {
 	uri := fmt.Sprintf(resourcesUri, forceApi.apiVersion)
 
-	return forceApi.Get(uri, nil, &forceApi.apiResources)
+	return forceApi.GetContext(ctx, uri, nil, &forceApi.apiResources)
 }
 
-func (forceApi *ForceApi) getApiSObjects() error {
+func (forceApi *ForceApi) getApiSObjects(ctx context.Context) error {
 	uri := forceApi.apiResources[sObjectsKey]
 
 	list := &SObjectApiResponse{}
-	err := forceApi.Get(uri, nil, list)
+	err := forceApi.GetContext(ctx, uri, nil, list)
 	if err != nil {
 		return err
 	}
@@ -182,12 +197,12 @@ func (forceApi *ForceApi) getApiSObjects() error {
 	return nil
 }
 
-func (forceApi *ForceApi) getApiSObjectDescriptions() error {
+func (forceApi *ForceApi) getApiSObjectDescriptions(ctx context.Context) error {
 	for name, metaData := range forceApi.apiSObjects {
 		uri := metaData.URLs[sObjectDescribeKey]
 
 		desc := &SObjectDescription{}
-		err := forceApi.Get(uri, nil, desc)
+		err := forceApi.GetContext(ctx, uri, nil, desc)
 		if err != nil {
 			return err
 		}
@@ -199,11 +214,31 @@ func (forceApi *ForceApi) getApiSObjectDescriptions() error {
 }
 
 func (forceApi *ForceApi) GetInstanceURL() string {
-	return forceApi.oauth.InstanceUrl
+	_, instanceUrl := forceApi.oauth.session()
+	return instanceUrl
 }
 
 func (forceApi *ForceApi) GetAccessToken() string {
-	return forceApi.oauth.AccessToken
+	accessToken, _ := forceApi.oauth.session()
+	return accessToken
+}
+
+// client returns the http.Client requests are sent with.
+func (forceApi *ForceApi) client() *http.Client {
+	if forceApi.httpClient != nil {
+		return forceApi.httpClient
+	}
+
+	return http.DefaultClient
+}
+
+// agent returns the User-Agent header value requests are sent with.
+func (forceApi *ForceApi) agent() string {
+	if len(forceApi.userAgent) != 0 {
+		return forceApi.userAgent
+	}
+
+	return userAgent
 }
 
 //GetStreams returns stream object
@@ -212,19 +247,35 @@ func (forceApi *ForceApi) GetStreams() *StreamsForce {
 }
 
 func (forceApi *ForceApi) RefreshToken() error {
+	return forceApi.RefreshTokenContext(context.Background())
+}
+
+// RefreshTokenContext is like RefreshToken but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) RefreshTokenContext(ctx context.Context) error {
+	forceApi.oauth.mu.RLock()
+	refreshToken := forceApi.oauth.refreshToken
+	forceApi.oauth.mu.RUnlock()
+
 	res := &RefreshTokenResponse{}
 	payload := map[string]string{
 		"grant_type":    "refresh_token",
-		"refresh_token": forceApi.oauth.refreshToken,
+		"refresh_token": refreshToken,
 		"client_id":     forceApi.oauth.clientId,
 		"client_secret": forceApi.oauth.clientSecret,
 	}
 
-	err := forceApi.Post("/services/oauth2/token", nil, payload, res)
+	err := forceApi.PostContext(ctx, "/services/oauth2/token", nil, payload, res)
 	if err != nil {
 		return err
 	}
 
-	forceApi.oauth.AccessToken = res.AccessToken
+	forceApi.oauth.setSession(&Token{
+		AccessToken: res.AccessToken,
+		Id:          res.ID,
+		IssuedAt:    res.IssuedAt,
+		Signature:   res.Signature,
+	})
+	forceApi.oauth.saveSession(ctx)
+
 	return nil
 }
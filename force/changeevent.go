@@ -0,0 +1,160 @@
+package force
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dewisuryani/go-force/forcejson"
+)
+
+// ChangeType is the operation a Change Data Capture event reports.
+type ChangeType string
+
+// Change types of Change Data Capture events. Gap events report changes that could not be
+// turned into regular events, e.g. made by a bulk operation on the database; they carry no
+// field values, so the records have to be read again. GAP_OVERFLOW reports that a single
+// transaction changed more records than can be published, without naming them.
+const (
+	ChangeCreate      ChangeType = "CREATE"
+	ChangeUpdate      ChangeType = "UPDATE"
+	ChangeDelete      ChangeType = "DELETE"
+	ChangeUndelete    ChangeType = "UNDELETE"
+	ChangeGapCreate   ChangeType = "GAP_CREATE"
+	ChangeGapUpdate   ChangeType = "GAP_UPDATE"
+	ChangeGapDelete   ChangeType = "GAP_DELETE"
+	ChangeGapUndelete ChangeType = "GAP_UNDELETE"
+	ChangeGapOverflow ChangeType = "GAP_OVERFLOW"
+)
+
+// IsGap reports whether the event is a gap event, including GAP_OVERFLOW.
+func (changeType ChangeType) IsGap() bool {
+	return strings.HasPrefix(string(changeType), "GAP_")
+}
+
+// ChangeEventHeader describes the change a Change Data Capture event reports.
+type ChangeEventHeader struct {
+	EntityName   string     `json:"entityName"`
+	RecordIDs    []string   `json:"recordIds"`
+	ChangeType   ChangeType `json:"changeType"`
+	ChangeOrigin string     `json:"changeOrigin"`
+
+	// TransactionKey identifies the transaction of the change, and SequenceNumber orders
+	// the events of one transaction.
+	TransactionKey string `json:"transactionKey"`
+	SequenceNumber int    `json:"sequenceNumber"`
+
+	// CommitTimestamp is in milliseconds since the epoch, see CommitTime.
+	CommitTimestamp int64  `json:"commitTimestamp"`
+	CommitNumber    int64  `json:"commitNumber"`
+	CommitUser      string `json:"commitUser"`
+
+	// ChangedFields lists the fields set by a create or changed by an update. Fields of
+	// compound fields are named like "BillingAddress.City".
+	ChangedFields []string `json:"changedFields"`
+	NulledFields  []string `json:"nulledFields"`
+	DiffFields    []string `json:"diffFields"`
+}
+
+// CommitTime returns the time the change was committed.
+func (header *ChangeEventHeader) CommitTime() time.Time {
+	return time.Unix(0, header.CommitTimestamp*int64(time.Millisecond))
+}
+
+// ChangeEvent is a Change Data Capture event, as delivered on /data/<entity>ChangeEvent.
+type ChangeEvent struct {
+	Channel  string
+	ReplayID int64
+	Header   ChangeEventHeader
+
+	// Payload holds the field values of the event, along with the header. Use Decode to
+	// read them into an sobjects struct.
+	Payload json.RawMessage
+}
+
+// DecodeChangeEvent decodes a message delivered to a streaming callback as a Change Data
+// Capture event.
+func DecodeChangeEvent(message []byte) (*ChangeEvent, error) {
+	msg := &bayeuxMessage{}
+	if err := json.Unmarshal(message, msg); err != nil {
+		return nil, err
+	}
+
+	replayID, _ := eventReplayID(msg.Data)
+	return decodeChangeEvent(msg.Channel, replayID, msg.Data)
+}
+
+// decodeChangeEvent decodes the data of a message delivered on channel.
+func decodeChangeEvent(channel string, replayID int64, data json.RawMessage) (*ChangeEvent, error) {
+	var event struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	if len(data) != 0 {
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, err
+		}
+	}
+	if len(event.Payload) == 0 {
+		return nil, errors.New("message has no change event payload")
+	}
+
+	var payload struct {
+		Header *ChangeEventHeader `json:"ChangeEventHeader"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Header == nil {
+		return nil, errors.New("message has no change event header")
+	}
+
+	return &ChangeEvent{
+		Channel:  channel,
+		ReplayID: replayID,
+		Header:   *payload.Header,
+		Payload:  event.Payload,
+	}, nil
+}
+
+// Decode reads the field values of the event into v, usually a pointer to an sobjects
+// struct. Only the changed fields are set for an update, see Header.ChangedFields; the
+// fields of compound fields such as addresses are nested under the compound field name.
+func (event *ChangeEvent) Decode(v interface{}) error {
+	return forcejson.Unmarshal(event.Payload, v)
+}
+
+// changeEventTopic returns the topic of the change events of an sObject: custom objects
+// publish on Name__ChangeEvent rather than Name__cChangeEvent.
+func changeEventTopic(sobject string) string {
+	if strings.HasSuffix(sobject, "__c") {
+		return strings.TrimSuffix(sobject, "c")
+	}
+
+	return sobject
+}
+
+// SubscribeChangeEvents subscribes to the Change Data Capture events of an sObject, e.g.
+// "Account" or "Invoice__c", and passes each of them to handler. Messages that cannot be
+// decoded are reported to the streaming error handler as a HandlerError, and their replay
+// id is not saved.
+func (forceAPI *ForceApi) SubscribeChangeEvents(sobject string, handler func(event *ChangeEvent),
+	opts ...SubscribeOption) (*Subscription, error) {
+	return forceAPI.SubscribeChangeEventsErr(sobject, func(event *ChangeEvent) error {
+		handler(event)
+		return nil
+	}, opts...)
+}
+
+// SubscribeChangeEventsErr is like SubscribeChangeEvents, but the replay id of an event is
+// not saved when handler returns an error, see SubscribeFuncErr.
+func (forceAPI *ForceApi) SubscribeChangeEventsErr(sobject string, handler func(event *ChangeEvent) error,
+	opts ...SubscribeOption) (*Subscription, error) {
+	return forceAPI.SubscribeFuncErr("CDC", changeEventTopic(sobject), func(msg *Message) error {
+		event, err := msg.ChangeEvent()
+		if err != nil {
+			return err
+		}
+		return handler(event)
+	}, opts...)
+}
@@ -0,0 +1,110 @@
+package force
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dewisuryani/go-force/sobjects"
+)
+
+const testChangeEvent = `{
+	"channel": "/data/AccountChangeEvent",
+	"data": {
+		"schema": "IeRuaY6cbI_HsV8Rv1Mc5g",
+		"payload": {
+			"ChangeEventHeader": {
+				"entityName": "Account",
+				"recordIds": ["001xx000003DGb2AAG"],
+				"changeType": "UPDATE",
+				"changeOrigin": "com/salesforce/api/soap/51.0;client=devconsole",
+				"transactionKey": "0002343d-9d90-e395-ed20-cf416ba652ad",
+				"sequenceNumber": 2,
+				"commitTimestamp": 1600000000000,
+				"commitNumber": 10585193272713,
+				"commitUser": "005xx000001SyCoAAK",
+				"changedFields": ["Name", "LastModifiedDate"],
+				"nulledFields": [],
+				"diffFields": []
+			},
+			"Name": "Acme Corp",
+			"LastModifiedDate": "2020-09-13T12:26:40.000+0000"
+		},
+		"event": {"replayId": 42}
+	}
+}`
+
+func TestDecodeChangeEvent(t *testing.T) {
+	event, err := DecodeChangeEvent([]byte(testChangeEvent))
+	if err != nil {
+		t.Fatalf("Unable to decode change event: %v", err)
+	}
+
+	header := event.Header
+	if event.Channel != "/data/AccountChangeEvent" || event.ReplayID != 42 {
+		t.Fatalf("Unexpected event: %v %v", event.Channel, event.ReplayID)
+	}
+	if header.EntityName != "Account" || header.ChangeType != ChangeUpdate || header.ChangeType.IsGap() ||
+		header.RecordIDs[0] != "001xx000003DGb2AAG" || header.SequenceNumber != 2 ||
+		len(header.ChangedFields) != 2 || !header.CommitTime().Equal(time.Unix(1600000000, 0)) {
+		t.Fatalf("Unexpected header: %+v", header)
+	}
+
+	account := &sobjects.Account{}
+	if err := event.Decode(account); err != nil {
+		t.Fatalf("Unable to decode payload: %v", err)
+	}
+	if account.Name != "Acme Corp" || account.LastModifiedDate == nil {
+		t.Fatalf("Unexpected account: %+v", account)
+	}
+
+	if _, err := DecodeChangeEvent([]byte(`{"channel":"/event/Order__e","data":{"payload":{"Amount__c":1}}}`)); err == nil {
+		t.Fatal("Expected a platform event not to decode as a change event")
+	}
+}
+
+func TestStreamingChangeEvents(t *testing.T) {
+	cometd := newFakeCometd(t)
+	store := NewMemoryReplayStore()
+	errs := make(chan error, 10)
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.replayStore = store
+	forceApi.onStreamError = func(err error) { errs <- err }
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+
+	events := make(chan *ChangeEvent, 10)
+	if _, err := forceApi.SubscribeChangeEvents("Invoice__c", func(event *ChangeEvent) { events <- event }); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	cometd.publish("/data/Invoice__ChangeEvent", `{"payload":{},"event":{"replayId":6}}`,
+		`{"payload":{"ChangeEventHeader":{"entityName":"Invoice__c","changeType":"GAP_OVERFLOW"}},"event":{"replayId":7}}`)
+
+	select {
+	case event := <-events:
+		if event.Header.ChangeType != ChangeGapOverflow || !event.Header.ChangeType.IsGap() || event.ReplayID != 7 {
+			t.Fatalf("Unexpected event: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the change event to be delivered")
+	}
+
+	forceApi.DisconnectStreamingAPI()
+
+	select {
+	case err := <-errs:
+		var handlerErr *HandlerError
+		if !errors.As(err, &handlerErr) || handlerErr.Message.ReplayID != 6 {
+			t.Fatalf("Expected the undecodable event to be reported, got: %v", err)
+		}
+	default:
+		t.Fatal("Expected the undecodable event to be reported")
+	}
+	// The position stays before the undecodable event.
+	if saved, err := store.Load(context.Background(), "/data/Invoice__ChangeEvent"); err != ErrReplayIDNotFound {
+		t.Fatalf("Expected no replay id to be saved, got %v %v", saved, err)
+	}
+}
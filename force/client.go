@@ -2,183 +2,292 @@ package force
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-
-	"github.com/sirupsen/logrus"
-	"github.com/ztrue/tracerr"
+	"strings"
 
 	"github.com/dewisuryani/go-force/forcejson"
 )
 
+// ErrUntrustedURL is returned for an absolute URL that is neither on the instance nor on
+// the identity host of the session, since the access token is never sent anywhere else.
+var ErrUntrustedURL = errors.New("url is not on the instance or identity host of the session")
+
 // Get issues a GET to the specified path with the given params and put the
 // umarshalled (json) result in the third parameter
 func (forceApi *ForceApi) Get(path string, params url.Values, out interface{}) error {
-	return forceApi.request("GET", path, params, nil, out)
+	return forceApi.GetContext(context.Background(), path, params, out)
+}
+
+// GetContext is like Get but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) GetContext(ctx context.Context, path string, params url.Values, out interface{}) error {
+	return forceApi.request(ctx, "GET", path, params, nil, out)
 }
 
 // Post issues a POST to the specified path with the given params and payload
 // and put the unmarshalled (json) result in the third parameter
 func (forceApi *ForceApi) Post(path string, params url.Values, payload, out interface{}) error {
-	return forceApi.request("POST", path, params, payload, out)
+	return forceApi.PostContext(context.Background(), path, params, payload, out)
+}
+
+// PostContext is like Post but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) PostContext(ctx context.Context, path string, params url.Values, payload, out interface{}) error {
+	return forceApi.request(ctx, "POST", path, params, payload, out)
 }
 
 // Put issues a PUT to the specified path with the given params and payload
 // and put the unmarshalled (json) result in the third parameter
 func (forceApi *ForceApi) Put(path string, params url.Values, payload, out interface{}) error {
-	return forceApi.request("PUT", path, params, payload, out)
+	return forceApi.PutContext(context.Background(), path, params, payload, out)
+}
+
+// PutContext is like Put but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) PutContext(ctx context.Context, path string, params url.Values, payload, out interface{}) error {
+	return forceApi.request(ctx, "PUT", path, params, payload, out)
 }
 
 // Patch issues a PATCH to the specified path with the given params and payload
 // and put the unmarshalled (json) result in the third parameter
 func (forceApi *ForceApi) Patch(path string, params url.Values, payload, out interface{}) error {
-	return forceApi.request("PATCH", path, params, payload, out)
+	return forceApi.PatchContext(context.Background(), path, params, payload, out)
+}
+
+// PatchContext is like Patch but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) PatchContext(ctx context.Context, path string, params url.Values, payload, out interface{}) error {
+	return forceApi.request(ctx, "PATCH", path, params, payload, out)
 }
 
 // Delete issues a DELETE to the specified path with the given payload
 func (forceApi *ForceApi) Delete(path string, params url.Values) error {
-	return forceApi.request("DELETE", path, params, nil, nil)
+	return forceApi.DeleteContext(context.Background(), path, params)
 }
 
-func (forceApi *ForceApi) request(method, path string, params url.Values, payload, out interface{}) error {
-	if err := forceApi.oauth.Validate(); err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"method": method,
-			"err":    err,
-		}).Error("error creating request")
+// DeleteContext is like Delete but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) DeleteContext(ctx context.Context, path string, params url.Values) error {
+	return forceApi.request(ctx, "DELETE", path, params, nil, nil)
+}
+
+func (forceApi *ForceApi) request(ctx context.Context, method, path string, params url.Values, payload, out interface{}) error {
+	// Build body
+	var jsonBytes []byte
+	if payload != nil {
+		var err error
+		jsonBytes, err = forcejson.Marshal(payload)
+		if err != nil {
+			forceApi.log.error("error marshaling encoded payload", "path", path, "err", err)
+			return err
+		}
+	}
+
+	resp, _, err := forceApi.do(ctx, method, path, params, nil, jsonBytes, true)
+	if err != nil {
 		return err
 	}
+	defer closeBody(resp)
+
+	// Sometimes the force API returns no body or no response is expected. For example
+	// delete and update.
+	if resp.StatusCode == http.StatusNoContent || out == nil {
+		return nil
+	}
+
+	if err := newResponseDecoder(resp).Decode(out); err != nil {
+		forceApi.log.error("error decoding response to object", "method", method, "path", path, "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// do sends the request, retrying transient failures as allowed by the retry policy. If
+// the session has expired and renewSession is set, the session is renewed and the request
+// sent once more. The body of a successful response is left open for the caller. A failed
+// response is returned along with its body and an *Error.
+func (forceApi *ForceApi) do(ctx context.Context, method, path string, params url.Values, header http.Header, payload []byte,
+	renewSession bool) (*http.Response, []byte, error) {
+	if err := forceApi.oauth.Validate(); err != nil {
+		forceApi.log.error("error creating request", "method", method, "err", err)
+		return nil, nil, err
+	}
+
+	if err := forceApi.usage.wait(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	accessToken, instanceUrl := forceApi.oauth.session()
 
 	// Build Uri
 	var uri bytes.Buffer
-	uri.WriteString(forceApi.oauth.InstanceUrl)
+	if !isAbsoluteURL(path) {
+		uri.WriteString(instanceUrl)
+	} else if !forceApi.oauth.trustedURL(path) {
+		forceApi.log.error("error creating request", "method", method, "err", ErrUntrustedURL)
+		return nil, nil, fmt.Errorf("%w: %v", ErrUntrustedURL, path)
+	}
 	uri.WriteString(path)
 	if params != nil && len(params) != 0 {
 		uri.WriteString("?")
 		uri.WriteString(params.Encode())
 	}
 
-	// Build body
-	var body io.Reader
-	if payload != nil {
+	// Send, retrying transient failures as allowed by the retry policy
+	var resp *http.Response
+	var respBytes []byte
+	var err error
+	for attempt := 1; ; attempt++ {
+		resp, respBytes, err = forceApi.send(withAttempt(ctx, attempt), method, uri.String(), accessToken, header, payload)
 
-		jsonBytes, err := forcejson.Marshal(payload)
-		if err != nil {
-			err = tracerr.Wrap(err)
-			logrus.WithFields(logrus.Fields{
-				"payload": payload,
-				"err":     err,
-			}).Error("error marshaling encoded payload")
-			return err
+		retryAttempt := newRetryAttempt(ctx, method, uri.String(), attempt, resp, respBytes, err)
+		wait, retry := forceApi.retryPolicy.backoff(retryAttempt)
+		if !retry {
+			break
 		}
 
-		body = bytes.NewReader(jsonBytes)
+		forceApi.log.warn("retrying request",
+			"method", method,
+			"path", path,
+			"attempt", attempt,
+			"wait", wait,
+			"err", retryAttempt.error())
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		forceErr := newError(method, path, resp, respBytes)
+
+		// Check if error is oauth token expired
+		if forceApi.oauth.Expired(forceErr.Errors) || badOAuthToken(resp, respBytes) {
+			// A renewed session that is rejected again will not get any better
+			if !renewSession {
+				return resp, respBytes, &SessionError{Err: forceErr}
+			}
+
+			// Reauthenticate then attempt query again
+			if oauthErr := forceApi.oauth.renew(ctx, accessToken); oauthErr != nil {
+				return resp, respBytes, oauthErr
+			}
+
+			return forceApi.do(ctx, method, path, params, header, payload, false)
+		}
+
+		return resp, respBytes, forceErr
+	}
+
+	return resp, nil, nil
+}
+
+func isAbsoluteURL(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// maxPresizedBody caps the buffer allocated upfront for a response body, so that a bogus
+// Content-Length does not make us allocate more than we need.
+const maxPresizedBody int64 = 64 << 20
+
+// newResponseDecoder decodes the body of resp as it is read. Bodies of known length are
+// read into a buffer of that size, so large query pages are not copied while growing it.
+func newResponseDecoder(resp *http.Response) *forcejson.Decoder {
+	if resp.ContentLength > 0 && resp.ContentLength <= maxPresizedBody {
+		return forcejson.NewDecoderSize(resp.Body, int(resp.ContentLength))
+	}
+
+	return forcejson.NewDecoder(resp.Body)
+}
+
+// closeBody drains what is left of a response body, so that the connection can be
+// reused, and closes it.
+func closeBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// send issues a single request. The body of a successful response is left for the caller
+// to decode and close. The body of a failed response is small, so it is read into
+// respBytes for the error and closed.
+func (forceApi *ForceApi) send(ctx context.Context, method, uri, accessToken string, header http.Header,
+	payload []byte) (*http.Response, []byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	kind := RESTCall
+	if isBulkPath(uri) {
+		kind = BulkCall
 	}
 
 	// Build Request
-	req, err := http.NewRequest(method, uri.String(), body)
+	req, err := http.NewRequestWithContext(withCallKind(ctx, kind), method, uri, body)
 	if err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"method": method,
-			"uri":    uri.String(),
-			"body":   body,
-			"err":    err,
-		}).Error("error creating http new request")
-		return err
+		forceApi.log.error("error creating http new request", "method", method, "err", err)
+		return nil, nil, err
 	}
 
 	// Add Headers
-	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("User-Agent", forceApi.agent())
 	req.Header.Set("Content-Type", jsonType)
 	req.Header.Set("Accept", jsonType)
-	req.Header.Set("Authorization", fmt.Sprintf("%v %v", "Bearer", forceApi.oauth.AccessToken))
+	req.Header.Set("Authorization", fmt.Sprintf("%v %v", "Bearer", accessToken))
+	for key, values := range header {
+		req.Header[http.CanonicalHeaderKey(key)] = values
+	}
+	if forceApi.gzip {
+		if err := compressRequest(req, payload, forceApi.gzipMinSize); err != nil {
+			forceApi.log.error("error compressing request", "method", method, "path", req.URL.Path, "err", err)
+			return nil, nil, err
+		}
+	}
 
 	// Send
 	forceApi.traceRequest(req)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := forceApi.client().Do(req)
 	if err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"method": method,
-			"req":    req,
-			"err":    err,
-		}).Error("error client do")
-		return err
+		forceApi.log.error("error client do", "method", method, "path", req.URL.Path, "err", err)
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
 	forceApi.traceResponse(resp)
+	forceApi.usage.record(resp.Header)
 
-	// Sometimes the force API returns no body, we should catch this early
-	if resp.StatusCode == http.StatusNoContent {
-		return nil
+	if resp.StatusCode < http.StatusBadRequest && forceApi.logger == nil {
+		return resp, nil, nil
 	}
 
+	// Tracing needs the whole body, successful responses are decoded from a copy of it.
 	respBytes, err := ioutil.ReadAll(resp.Body)
+	closeBody(resp)
 	if err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"body": resp.Body,
-			"err":  err,
-		}).Error("error reading response bytes")
-		return err
+		forceApi.log.error("error reading response bytes", "method", method, "path", req.URL.Path, "err", err)
+		return nil, nil, err
 	}
 	forceApi.traceResponseBody(respBytes)
 
-	// Attempt to parse response into out
-	var objectUnmarshalErr error
-	if out != nil {
-		objectUnmarshalErr = forcejson.Unmarshal(respBytes, out)
-		if objectUnmarshalErr == nil {
-			return nil
-		}
+	if resp.StatusCode < http.StatusBadRequest {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(respBytes))
+		return resp, nil, nil
 	}
 
-	// Attempt to parse response as a force.com api error before returning object unmarshal err
-	apiErrors := APIErrors{}
-	if marshalErr := forcejson.Unmarshal(respBytes, &apiErrors); marshalErr == nil {
-		if apiErrors.Validate() {
-			// Check if error is oauth token expired
-			if forceApi.oauth.Expired(apiErrors) {
-				// Reauthenticate then attempt query again
-				oauthErr := forceApi.oauth.Authenticate()
-				if oauthErr != nil {
-					return oauthErr
-				}
-
-				return forceApi.request(method, path, params, payload, out)
-			}
-
-			return apiErrors
-		}
-	}
-
-	if objectUnmarshalErr != nil {
-		// Not a force.com api error. Just an unmarshalling error.
-		err = tracerr.Wrap(objectUnmarshalErr)
-		logrus.WithFields(logrus.Fields{
-			"err": err,
-		}).Error("error unmarshal response to object")
-		return err
-	}
-
-	// Sometimes no response is expected. For example delete and update. We still have to make sure an error wasn't returned.
-	return nil
+	return resp, respBytes, nil
 }
 
 func (forceApi *ForceApi) traceRequest(req *http.Request) {
 	if forceApi.logger != nil {
-		forceApi.trace("Request:", req, "%v")
+		forceApi.trace("Request:", forceApi.log.redactRequest(req), "%v")
 	}
 }
 
 func (forceApi *ForceApi) traceResponse(resp *http.Response) {
 	if forceApi.logger != nil {
-		forceApi.trace("Response:", resp, "%v")
+		forceApi.trace("Response:", forceApi.log.redactResponse(resp), "%v")
 	}
 }
 
@@ -0,0 +1,194 @@
+package force
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dewisuryani/go-force/forcejson"
+)
+
+// fakeForce is a local stand-in for the force.com login and REST endpoints.
+// Tests register extra handlers on mux, and may replace the token endpoint with token.
+type fakeForce struct {
+	*httptest.Server
+	mux           *http.ServeMux
+	token         http.HandlerFunc
+	tokenRequests int32
+}
+
+func newFakeForce(t *testing.T) *fakeForce {
+	fake := &fakeForce{mux: http.NewServeMux()}
+	fake.Server = httptest.NewServer(fake.mux)
+	t.Cleanup(fake.Close)
+
+	fake.mux.HandleFunc(oauthURL, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&fake.tokenRequests, 1)
+		if fake.token != nil {
+			fake.token(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", jsonType)
+		fmt.Fprintf(w, `{"access_token":"token-%d","instance_url":"%s","id":"%s/id/00D/005","issued_at":"1600000000000"}`,
+			n, fake.URL, fake.URL)
+	})
+	fake.mux.HandleFunc(fmt.Sprintf(resourcesUri, testVersion), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"sobjects":"/services/data/%[1]s/sobjects","query":"/services/data/%[1]s/query","limits":"/services/data/%[1]s/limits"}`,
+			testVersion)
+	})
+	fake.mux.HandleFunc(fmt.Sprintf(resourcesUri, testVersion)+"/sobjects", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"maxBatchSize":200,"sobjects":[{"name":"Account","urls":{"sobject":"/services/data/%[1]s/sobjects/Account","describe":"/services/data/%[1]s/sobjects/Account/describe","rowTemplate":"/services/data/%[1]s/sobjects/Account/{ID}"}}]}`,
+			testVersion)
+	})
+
+	return fake
+}
+
+// newTestForceApi returns a ForceApi that talks to the given local server instead of force.com.
+func newTestForceApi(serverURL string) *ForceApi {
+	return &ForceApi{
+		apiResources:           make(map[string]string),
+		apiSObjects:            make(map[string]*SObjectMetaData),
+		apiSObjectDescriptions: make(map[string]*SObjectDescription),
+		apiVersion:             testVersion,
+		oauth: &forceOauth{
+			AccessToken: "test-access-token",
+			InstanceUrl: serverURL,
+		},
+	}
+}
+
+func TestRequestContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	forceApi := newTestForceApi(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	out := map[string]interface{}{}
+	err := forceApi.GetContext(ctx, "/services/data/v36.0", nil, &out)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded error, got: %v", err)
+	}
+}
+
+func TestRequestContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Request should not reach the server once the context is canceled")
+	}))
+	defer server.Close()
+
+	forceApi := newTestForceApi(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := map[string]interface{}{}
+	err := forceApi.QueryContext(ctx, "SELECT Id FROM Account", &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected canceled error, got: %v", err)
+	}
+}
+
+type benchmarkRecord struct {
+	Id          string
+	Name        string
+	Description string
+}
+
+type benchmarkQueryPage struct {
+	TotalSize int
+	Done      bool
+	Records   []*benchmarkRecord
+}
+
+// newBenchmarkQueryPage returns a query page of 2,000 records with long text fields.
+func newBenchmarkQueryPage(b *testing.B) []byte {
+	page := &benchmarkQueryPage{TotalSize: 2000, Done: true}
+	for i := 0; i < 2000; i++ {
+		page.Records = append(page.Records, &benchmarkRecord{
+			Id:          fmt.Sprintf("001%015d", i),
+			Name:        fmt.Sprintf("Account %d", i),
+			Description: strings.Repeat("lorem ipsum dolor sit amet ", 40),
+		})
+	}
+
+	pageBytes, err := forcejson.Marshal(page)
+	if err != nil {
+		b.Fatalf("Unable to marshal query page: %v", err)
+	}
+
+	return pageBytes
+}
+
+// BenchmarkDecodeQueryPage compares decoding straight from a response body of known length
+// with reading the whole body first, as requests used to.
+func BenchmarkDecodeQueryPage(b *testing.B) {
+	pageBytes := newBenchmarkQueryPage(b)
+
+	b.Run("ReadAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			body, err := ioutil.ReadAll(ioutil.NopCloser(bytes.NewReader(pageBytes)))
+			if err != nil {
+				b.Fatal(err)
+			}
+			out := &benchmarkQueryPage{}
+			if err := forcejson.Unmarshal(body, out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Decoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			resp := &http.Response{
+				Body:          ioutil.NopCloser(bytes.NewReader(pageBytes)),
+				ContentLength: int64(len(pageBytes)),
+			}
+			out := &benchmarkQueryPage{}
+			if err := newResponseDecoder(resp).Decode(out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkGetQueryPage(b *testing.B) {
+	pageBytes := newBenchmarkQueryPage(b)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(pageBytes)))
+		w.Write(pageBytes)
+	}))
+	defer server.Close()
+
+	forceApi := newTestForceApi(server.URL)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := &benchmarkQueryPage{}
+		if err := forceApi.Get("/services/data/"+testVersion+"/query", nil, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package force
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bayeux meta channels and the values of the reconnect advice, see
+// https://docs.cometd.org/current/reference/#_bayeux.
+const (
+	metaHandshake   string = "/meta/handshake"
+	metaConnect     string = "/meta/connect"
+	metaSubscribe   string = "/meta/subscribe"
+	metaUnsubscribe string = "/meta/unsubscribe"
+	metaDisconnect  string = "/meta/disconnect"
+
+	bayeuxVersion string = "1.0"
+	longPolling   string = "long-polling"
+
+	reconnectRetry     string = "retry"
+	reconnectHandshake string = "handshake"
+	reconnectNone      string = "none"
+)
+
+// ErrStreamingNoReconnect is reported when the server advises the client not to reconnect,
+// which stops the streaming loop.
+var ErrStreamingNoReconnect = errors.New("the streaming api advised not to reconnect")
+
+// streamMaxBackoff caps the time the streaming loop waits on top of the advised interval
+// after consecutive failures.
+var streamMaxBackoff = time.Minute
+
+// streamNetworkDelay is added to the time the server advises it holds a connect request,
+// before the request is given up on.
+var streamNetworkDelay = 10 * time.Second
+
+// bayeuxMessage is a message sent to or received from the CometD server.
+type bayeuxMessage struct {
+	Channel                  string                 `json:"channel"`
+	ID                       string                 `json:"id,omitempty"`
+	ClientID                 string                 `json:"clientId,omitempty"`
+	Version                  string                 `json:"version,omitempty"`
+	SupportedConnectionTypes []string               `json:"supportedConnectionTypes,omitempty"`
+	ConnectionType           string                 `json:"connectionType,omitempty"`
+	Subscription             string                 `json:"subscription,omitempty"`
+	Successful               bool                   `json:"successful,omitempty"`
+	Error                    string                 `json:"error,omitempty"`
+	Advice                   *bayeuxAdvice          `json:"advice,omitempty"`
+	Data                     json.RawMessage        `json:"data,omitempty"`
+	Ext                      map[string]interface{} `json:"ext,omitempty"`
+
+	// raw is the message as received.
+	raw json.RawMessage
+}
+
+// bayeuxAdvice tells the client how to reconnect. Interval and Timeout are in milliseconds.
+type bayeuxAdvice struct {
+	Reconnect string `json:"reconnect,omitempty"`
+	Interval  int    `json:"interval,omitempty"`
+	Timeout   int    `json:"timeout,omitempty"`
+}
+
+func (msg *bayeuxMessage) isMeta() bool {
+	return strings.HasPrefix(msg.Channel, "/meta/")
+}
+
+// BayeuxError is an unsuccessful reply of the CometD server to a handshake, connect,
+// subscribe, unsubscribe or disconnect. Salesforce formats errors as code:args:message,
+// e.g. "403::Unknown client".
+type BayeuxError struct {
+	Channel string
+	Code    int
+	Args    []string
+	Message string
+
+	// Subscription is the channel a failed subscribe or unsubscribe was about.
+	Subscription string
+}
+
+func newBayeuxError(msg *bayeuxMessage) *BayeuxError {
+	bayeuxErr := &BayeuxError{
+		Channel:      msg.Channel,
+		Message:      msg.Error,
+		Subscription: msg.Subscription,
+	}
+
+	parts := strings.SplitN(msg.Error, ":", 3)
+	if len(parts) == 3 {
+		if code, err := strconv.Atoi(parts[0]); err == nil {
+			bayeuxErr.Code = code
+			if len(parts[1]) != 0 {
+				bayeuxErr.Args = strings.Split(parts[1], ",")
+			}
+			bayeuxErr.Message = parts[2]
+		}
+	}
+
+	return bayeuxErr
+}
+
+func (err *BayeuxError) Error() string {
+	if len(err.Message) == 0 {
+		return fmt.Sprintf("%v failed", err.Channel)
+	}
+	return fmt.Sprintf("%v failed: %v", err.Channel, err.Message)
+}
+
+// UnknownClient reports whether the server no longer knows the client id, e.g. after the
+// client was idle too long, so that the client has to handshake again.
+func (err *BayeuxError) UnknownClient() bool {
+	return err.Code == http.StatusForbidden && strings.EqualFold(err.Message, "Unknown client")
+}
+
+// streamStatusError is returned for a CometD request answered with an HTTP error.
+type streamStatusError struct {
+	statusCode  int
+	body        []byte
+	accessToken string
+}
+
+func (err *streamStatusError) Error() string {
+	return fmt.Sprintf("streaming request failed with status %v: %s", err.statusCode, err.body)
+}
+
+// send posts msg to the CometD endpoint and returns the messages of the reply.
+func (s *StreamsForce) send(ctx context.Context, msg *bayeuxMessage) ([]*bayeuxMessage, error) {
+	s.mu.Lock()
+	s.messageID++
+	msg.ID = strconv.FormatInt(s.messageID, 10)
+	s.mu.Unlock()
+
+	payload, err := json.Marshal([]*bayeuxMessage{msg})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, accessToken, err := s.httpPost(ctx, msg.Channel, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.APIForce.log.debug("perform task", "channel", msg.Channel, "status", resp.StatusCode)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, &streamStatusError{statusCode: resp.StatusCode, body: respBytes, accessToken: accessToken}
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(respBytes, &raws); err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*bayeuxMessage, 0, len(raws))
+	for _, raw := range raws {
+		reply := &bayeuxMessage{}
+		if err := json.Unmarshal(raw, reply); err != nil {
+			return nil, err
+		}
+		reply.raw = raw
+		msgs = append(msgs, reply)
+	}
+
+	return msgs, nil
+}
+
+// reply returns the reply on the meta channel among msgs, taking in its advice. It returns
+// a *BayeuxError when the server reports the request as unsuccessful.
+func (s *StreamsForce) reply(channel string, msgs []*bayeuxMessage) (*bayeuxMessage, error) {
+	for _, msg := range msgs {
+		if msg.Channel != channel {
+			continue
+		}
+
+		if msg.Advice != nil {
+			s.mu.Lock()
+			s.advice = *msg.Advice
+			s.mu.Unlock()
+		}
+		if !msg.Successful {
+			return msg, newBayeuxError(msg)
+		}
+		return msg, nil
+	}
+
+	return nil, fmt.Errorf("no reply on %v", channel)
+}
+
+// handshake negotiates a new client id with the server.
+func (s *StreamsForce) handshake(ctx context.Context) error {
+	msgs, err := s.send(ctx, &bayeuxMessage{
+		Channel:                  metaHandshake,
+		Version:                  bayeuxVersion,
+		SupportedConnectionTypes: []string{longPolling},
+		Ext:                      map[string]interface{}{replayExtension: true},
+	})
+	if err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+
+	msg, err := s.reply(metaHandshake, msgs)
+	if err != nil {
+		return err
+	}
+	if len(msg.ClientID) == 0 {
+		return errors.New("handshake response has no client id")
+	}
+
+	s.mu.Lock()
+	s.ClientID = msg.ClientID
+	s.mu.Unlock()
+
+	return nil
+}
+
+// connect sends a long poll and returns the messages it delivered. The reply to the
+// connect itself is checked for errors, but is not part of the returned messages.
+func (s *StreamsForce) connect(ctx context.Context) ([]*bayeuxMessage, error) {
+	s.mu.Lock()
+	clientID := s.ClientID
+	timeout := s.advice.Timeout
+	s.mu.Unlock()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond+streamNetworkDelay)
+		defer cancel()
+	}
+
+	msgs, err := s.send(ctx, &bayeuxMessage{
+		Channel:        metaConnect,
+		ClientID:       clientID,
+		ConnectionType: longPolling,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect failed: %w", err)
+	}
+
+	delivered := make([]*bayeuxMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		if !msg.isMeta() {
+			delivered = append(delivered, msg)
+		}
+	}
+
+	_, err = s.reply(metaConnect, msgs)
+	return delivered, err
+}
+
+// subscribe asks the server to deliver the messages of channel, from its replay position.
+func (s *StreamsForce) subscribe(ctx context.Context, channel string) ([]*bayeuxMessage, error) {
+	return s.meta(ctx, metaSubscribe, channel, s.replayExt(channel))
+}
+
+// unsubscribe asks the server to stop delivering the messages of channel.
+func (s *StreamsForce) unsubscribe(ctx context.Context, channel string) ([]*bayeuxMessage, error) {
+	return s.meta(ctx, metaUnsubscribe, channel, nil)
+}
+
+// disconnect tells the server the client is going away.
+func (s *StreamsForce) disconnect(ctx context.Context) ([]*bayeuxMessage, error) {
+	return s.meta(ctx, metaDisconnect, "", nil)
+}
+
+// meta sends a request on a meta channel with the current client id and checks its reply.
+func (s *StreamsForce) meta(ctx context.Context, channel, subscription string,
+	ext map[string]interface{}) ([]*bayeuxMessage, error) {
+	s.mu.Lock()
+	clientID := s.ClientID
+	s.mu.Unlock()
+
+	msgs, err := s.send(ctx, &bayeuxMessage{
+		Channel:      channel,
+		ClientID:     clientID,
+		Subscription: subscription,
+		Ext:          ext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.reply(channel, msgs)
+	return msgs, err
+}
+
+// run polls /meta/connect until the stream is disconnected or the server advises not to
+// reconnect. It follows the advice of the server on how long to wait between polls, and
+// handshakes again and restores the subscriptions whenever the server forgets the client.
+func (s *StreamsForce) run() {
+	defer close(s.stopped)
+
+	// failures counts the consecutive failed connects and handshakes, to back off from a
+	// server that keeps failing.
+	failures := 0
+	rehandshake := false
+	for s.ctx.Err() == nil {
+		if rehandshake {
+			if err := s.rehandshake(s.ctx); err != nil {
+				if s.ctx.Err() != nil {
+					return
+				}
+				s.reportError(err)
+				failures++
+				if !s.sleep(streamBackoff(failures)) {
+					return
+				}
+				continue
+			}
+			rehandshake = false
+		}
+		s.redeliver(s.ctx)
+
+		msgs, err := s.connect(s.ctx)
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.dispatch(msgs)
+
+		reconnect, delay := s.reconnectAdvice(err)
+		if err != nil {
+			s.reportError(err)
+			failures++
+			delay += streamBackoff(failures)
+		} else {
+			failures = 0
+		}
+
+		switch reconnect {
+		case reconnectNone:
+			s.reportError(ErrStreamingNoReconnect)
+			return
+		case reconnectHandshake:
+			rehandshake = true
+		}
+
+		if !s.sleep(delay) {
+			return
+		}
+	}
+}
+
+// reconnectAdvice decides how to go on after a connect that failed with err, following
+// the advice of the server when it gave any. run adds the backoff for failed connects to
+// the advised interval.
+func (s *StreamsForce) reconnectAdvice(err error) (reconnect string, delay time.Duration) {
+	s.mu.Lock()
+	advice := s.advice
+	s.mu.Unlock()
+
+	interval := time.Duration(advice.Interval) * time.Millisecond
+
+	var bayeuxErr *BayeuxError
+	var statusErr *streamStatusError
+	switch {
+	case err == nil:
+		if advice.Reconnect == reconnectNone {
+			return reconnectNone, 0
+		}
+		return reconnectRetry, interval
+	case errors.As(err, &bayeuxErr):
+		if bayeuxErr.UnknownClient() {
+			return reconnectHandshake, interval
+		}
+		if len(advice.Reconnect) != 0 {
+			return advice.Reconnect, interval
+		}
+	case errors.As(err, &statusErr) && statusErr.statusCode == http.StatusUnauthorized:
+		// The session expired; the client id belonged to it.
+		if renewErr := s.APIForce.oauth.renew(s.ctx, statusErr.accessToken); renewErr != nil {
+			s.reportError(renewErr)
+		}
+		return reconnectHandshake, 0
+	}
+
+	return reconnectRetry, interval
+}
+
+// streamBackoff returns the time to wait on top of the advised interval after the given
+// number of consecutive failures: streamRetryDelay more for each of them, up to
+// streamMaxBackoff.
+func streamBackoff(failures int) time.Duration {
+	if time.Duration(failures) > streamMaxBackoff/streamRetryDelay {
+		return streamMaxBackoff
+	}
+
+	return time.Duration(failures) * streamRetryDelay
+}
+
+// rehandshake negotiates a new client id and subscribes it to every channel subscribed
+// so far.
+func (s *StreamsForce) rehandshake(ctx context.Context) error {
+	if err := s.handshake(ctx); err != nil {
+		return err
+	}
+
+	for _, channel := range s.subscribed() {
+		if _, err := s.subscribe(ctx, channel); err != nil {
+			s.reportError(err)
+			continue
+		}
+		s.resubscribed(channel)
+	}
+
+	return nil
+}
+
+// sleep waits for d, returning false when the stream is disconnected in the meantime.
+func (s *StreamsForce) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return s.ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-s.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
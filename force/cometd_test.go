@@ -0,0 +1,380 @@
+package force
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCometd is a CometD server speaking the subset of Bayeux used by Salesforce, served
+// next to the fake OAuth and REST endpoints.
+type fakeCometd struct {
+	*fakeForce
+
+	mu            sync.Mutex
+	token         string
+	clients       map[string]bool
+	handshakes    int
+	subscriptions []string
+	advice        bayeuxAdvice
+	connectStatus int
+	connectErr    string
+	subscribeErr  string
+	events        chan *bayeuxMessage
+	requests      []*bayeuxMessage
+
+	// retain keeps the published events, and delivers them again to a subscription from
+	// a replay id before them, as Salesforce does.
+	retain   bool
+	retained []*bayeuxMessage
+}
+
+func newFakeCometd(t *testing.T) *fakeCometd {
+	cometd := &fakeCometd{
+		fakeForce: newFakeForce(t),
+		clients:   make(map[string]bool),
+		advice:    bayeuxAdvice{Reconnect: reconnectRetry, Timeout: 100},
+		events:    make(chan *bayeuxMessage, 100),
+	}
+	cometd.mux.HandleFunc("/cometd/"+CometdVersion, cometd.serve)
+
+	return cometd
+}
+
+func (cometd *fakeCometd) serve(w http.ResponseWriter, r *http.Request) {
+	cometd.mu.Lock()
+	token, status := cometd.token, cometd.connectStatus
+	cometd.mu.Unlock()
+	if len(token) != 0 && r.Header.Get("Authorization") != "OAuth "+token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var msgs []*bayeuxMessage
+	if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil || len(msgs) != 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	msg := msgs[0]
+	if msg.Channel == metaConnect && status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	json.NewEncoder(w).Encode(cometd.reply(msg))
+}
+
+func (cometd *fakeCometd) reply(msg *bayeuxMessage) []*bayeuxMessage {
+	cometd.mu.Lock()
+	defer cometd.mu.Unlock()
+
+	cometd.requests = append(cometd.requests, msg)
+
+	reply := &bayeuxMessage{Channel: msg.Channel, ID: msg.ID, ClientID: msg.ClientID, Subscription: msg.Subscription}
+	if msg.Channel == metaHandshake {
+		cometd.handshakes++
+		reply.ClientID = fmt.Sprintf("client-%d", cometd.handshakes)
+		reply.Successful = true
+		cometd.clients[reply.ClientID] = true
+		return []*bayeuxMessage{reply}
+	}
+
+	if !cometd.clients[msg.ClientID] {
+		reply.Error = "403::Unknown client"
+		reply.Advice = &bayeuxAdvice{Reconnect: reconnectHandshake}
+		return []*bayeuxMessage{reply}
+	}
+
+	switch msg.Channel {
+	case metaConnect:
+		advice := cometd.advice
+		reply.Advice = &advice
+		reply.Successful = advice.Reconnect != reconnectNone && len(cometd.connectErr) == 0
+		reply.Error = cometd.connectErr
+		replies := []*bayeuxMessage{reply}
+
+		// Hold the poll briefly, like a real long poll, unless events are waiting.
+		cometd.mu.Unlock()
+		select {
+		case event := <-cometd.events:
+			replies = append(replies, event)
+		case <-time.After(10 * time.Millisecond):
+		}
+		cometd.mu.Lock()
+		for len(cometd.events) > 0 {
+			replies = append(replies, <-cometd.events)
+		}
+
+		return replies
+	case metaSubscribe:
+		if len(cometd.subscribeErr) != 0 {
+			reply.Error = cometd.subscribeErr
+			return []*bayeuxMessage{reply}
+		}
+		cometd.subscriptions = append(cometd.subscriptions, msg.Subscription)
+		if cometd.retain {
+			cometd.replay(msg)
+		}
+	case metaDisconnect:
+		delete(cometd.clients, msg.ClientID)
+	}
+
+	reply.Successful = true
+	return []*bayeuxMessage{reply}
+}
+
+// publish delivers data on channel with the next connect. Several events are delivered
+// with the same connect.
+func (cometd *fakeCometd) publish(channel string, data ...string) {
+	cometd.mu.Lock()
+	defer cometd.mu.Unlock()
+
+	for _, event := range data {
+		msg := &bayeuxMessage{Channel: channel, Data: json.RawMessage(event)}
+		if cometd.retain {
+			cometd.retained = append(cometd.retained, msg)
+		}
+		cometd.events <- msg
+	}
+}
+
+// replay restarts the delivery of the channel of a subscribe request from its replay id:
+// the pending events of the channel are replaced by the retained events after it.
+func (cometd *fakeCometd) replay(subscribe *bayeuxMessage) {
+	replay, _ := subscribe.Ext[replayExtension].(map[string]interface{})
+	from, ok := replay[subscribe.Subscription].(float64)
+	if !ok {
+		return
+	}
+
+	for n := len(cometd.events); n > 0; n-- {
+		if event := <-cometd.events; event.Channel != subscribe.Subscription {
+			cometd.events <- event
+		}
+	}
+	for _, event := range cometd.retained {
+		replayID, _ := eventReplayID(event.Data)
+		if event.Channel == subscribe.Subscription && int64(from) != ReplayNewEvents &&
+			(int64(from) == ReplayAllEvents || replayID > int64(from)) {
+			cometd.events <- event
+		}
+	}
+}
+
+// forget drops every client, as the server does with idle clients.
+func (cometd *fakeCometd) forget() {
+	cometd.mu.Lock()
+	defer cometd.mu.Unlock()
+
+	cometd.clients = make(map[string]bool)
+}
+
+func (cometd *fakeCometd) stats() (handshakes int, subscriptions []string) {
+	cometd.mu.Lock()
+	defer cometd.mu.Unlock()
+
+	return cometd.handshakes, append([]string(nil), cometd.subscriptions...)
+}
+
+// sent returns the requests received on channel.
+func (cometd *fakeCometd) sent(channel string) []*bayeuxMessage {
+	cometd.mu.Lock()
+	defer cometd.mu.Unlock()
+
+	var requests []*bayeuxMessage
+	for _, msg := range cometd.requests {
+		if msg.Channel == channel {
+			requests = append(requests, msg)
+		}
+	}
+
+	return requests
+}
+
+func (cometd *fakeCometd) waitForHandshakes(t *testing.T, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for handshakes, _ := cometd.stats(); handshakes < n; handshakes, _ = cometd.stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %v handshakes, got %v", n, handshakes)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// receiveMessages collects the data of the messages passed to its callback.
+type receiveMessages chan string
+
+func (received receiveMessages) callback(message []byte, _ ...interface{}) {
+	msg := &bayeuxMessage{}
+	json.Unmarshal(message, msg)
+	received <- string(msg.Data)
+}
+
+func (received receiveMessages) expect(t *testing.T, data string) {
+	t.Helper()
+
+	select {
+	case got := <-received:
+		if got != data {
+			t.Fatalf("Expected %v to be delivered, got %v", data, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected %v to be delivered", data)
+	}
+}
+
+func connectTestStream(t *testing.T, cometd *fakeCometd, onError func(error)) *ForceApi {
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.onStreamError = onError
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	t.Cleanup(func() { forceApi.DisconnectStreamingAPI() })
+
+	return forceApi
+}
+
+func TestStreamingDeliversMessagesPerChannel(t *testing.T) {
+	cometd := newFakeCometd(t)
+	forceApi := connectTestStream(t, cometd, nil)
+
+	accounts, contacts := make(receiveMessages, 10), make(receiveMessages, 10)
+	if _, err := forceApi.Subscribe("CDC", "Account", accounts.callback); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+	if _, err := forceApi.Subscribe("CDC", "Contact", contacts.callback); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	cometd.publish("/data/AccountChangeEvent", `{"n":1}`)
+	cometd.publish("/data/OpportunityChangeEvent", `{"n":2}`)
+	cometd.publish("/data/AccountChangeEvent", `{"n":3}`)
+	cometd.publish("/data/ContactChangeEvent", `{"n":4}`)
+
+	accounts.expect(t, `{"n":1}`)
+	accounts.expect(t, `{"n":3}`)
+	contacts.expect(t, `{"n":4}`)
+}
+
+func TestStreamingRehandshake(t *testing.T) {
+	cometd := newFakeCometd(t)
+	forceApi := connectTestStream(t, cometd, func(error) {})
+
+	accounts := make(receiveMessages, 10)
+	if _, err := forceApi.Subscribe("CDC", "Account", accounts.callback); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	cometd.forget()
+	cometd.waitForHandshakes(t, 2)
+	cometd.publish("/data/AccountChangeEvent", `{"n":1}`)
+	accounts.expect(t, `{"n":1}`)
+
+	handshakes, subscriptions := cometd.stats()
+	if handshakes != 2 || len(subscriptions) != 2 || subscriptions[1] != "/data/AccountChangeEvent" {
+		t.Fatalf("Expected the client to handshake and subscribe again, got %v handshakes and subscriptions %v",
+			handshakes, subscriptions)
+	}
+}
+
+func TestStreamingRenewsSession(t *testing.T) {
+	cometd := newFakeCometd(t)
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.oauth.loginURI = cometd.URL
+	forceApi.oauth.flow = refreshTokenFlow
+	forceApi.oauth.AccessToken = "stale"
+	forceApi.onStreamError = func(error) {}
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer forceApi.DisconnectStreamingAPI()
+
+	accounts := make(receiveMessages, 10)
+	if _, err := forceApi.Subscribe("CDC", "Account", accounts.callback); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	cometd.mu.Lock()
+	cometd.token = "token-1"
+	cometd.mu.Unlock()
+	cometd.waitForHandshakes(t, 2)
+	cometd.publish("/data/AccountChangeEvent", `{"n":1}`)
+	accounts.expect(t, `{"n":1}`)
+
+	if handshakes, _ := cometd.stats(); handshakes != 2 || forceApi.GetAccessToken() != "token-1" {
+		t.Fatalf("Expected the session to be renewed before handshaking again, got %v handshakes with %v",
+			handshakes, forceApi.GetAccessToken())
+	}
+}
+
+func TestStreamingAdviceNone(t *testing.T) {
+	cometd := newFakeCometd(t)
+	errs := make(chan error, 10)
+	forceApi := connectTestStream(t, cometd, func(err error) { errs <- err })
+
+	cometd.mu.Lock()
+	cometd.advice = bayeuxAdvice{Reconnect: reconnectNone}
+	cometd.mu.Unlock()
+
+	select {
+	case <-forceApi.stream.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the streaming loop to stop")
+	}
+
+	for len(errs) > 0 {
+		if err := <-errs; err == ErrStreamingNoReconnect {
+			return
+		}
+	}
+	t.Fatal("Expected the stop to be reported")
+}
+
+func TestStreamingBacksOff(t *testing.T) {
+	defer func(delay, max time.Duration) {
+		streamRetryDelay, streamMaxBackoff = delay, max
+	}(streamRetryDelay, streamMaxBackoff)
+	streamRetryDelay, streamMaxBackoff = 20*time.Millisecond, 60*time.Millisecond
+
+	cometd := newFakeCometd(t)
+	errs := make(chan error, 100)
+	forceApi := connectTestStream(t, cometd, func(err error) { errs <- err })
+
+	// Salesforce advises to retry right away after a failed connect.
+	cometd.mu.Lock()
+	cometd.advice = bayeuxAdvice{Reconnect: reconnectRetry, Interval: 0}
+	cometd.connectErr = "500::Internal error"
+	cometd.mu.Unlock()
+
+	// Waiting 20, 40, 60, 60... ms between connects leaves room for about 5 in 300ms.
+	time.Sleep(300 * time.Millisecond)
+	forceApi.DisconnectStreamingAPI()
+	if failed := len(errs); failed < 2 || failed > 7 {
+		t.Fatalf("Expected failed connects to back off, got %v failures", failed)
+	}
+
+	if streamBackoff(1) != 20*time.Millisecond || streamBackoff(2) != 40*time.Millisecond ||
+		streamBackoff(100) != streamMaxBackoff {
+		t.Fatalf("Unexpected backoff: %v %v %v", streamBackoff(1), streamBackoff(2), streamBackoff(100))
+	}
+}
+
+func TestBayeuxError(t *testing.T) {
+	err := newBayeuxError(&bayeuxMessage{Channel: metaConnect, Error: "403::Unknown client"})
+	if err.Code != 403 || len(err.Args) != 0 || !err.UnknownClient() {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+
+	err = newBayeuxError(&bayeuxMessage{Channel: metaSubscribe, Error: "400:/topic/Missing:Invalid channel"})
+	if err.Code != 400 || err.Args[0] != "/topic/Missing" || err.Message != "Invalid channel" || err.UnknownClient() {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	if err.Error() != "/meta/subscribe failed: Invalid channel" {
+		t.Fatalf("Unexpected message: %v", err)
+	}
+}
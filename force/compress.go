@@ -0,0 +1,107 @@
+package force
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const gzipEncoding string = "gzip"
+
+// WithGzip compresses REST request bodies of at least minSize bytes and asks Salesforce
+// to compress responses, which are decompressed before interceptors see them. Small
+// payloads are sent as is, since compressing them costs more than it saves.
+func WithGzip(minSize int) Option {
+	return func(o *options) {
+		o.gzip = true
+		o.gzipMinSize = minSize
+	}
+}
+
+// compressRequest gzips the body of req when it is at least minSize bytes long.
+func compressRequest(req *http.Request, payload []byte, minSize int) error {
+	if len(payload) == 0 || len(payload) < minSize {
+		return nil
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(payload); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	body := compressed.Bytes()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Encoding", gzipEncoding)
+
+	return nil
+}
+
+// gzipTransport asks for gzipped responses and decompresses them below the interceptors,
+// so that they see the plain body. Setting Accept-Encoding keeps http.Transport from
+// doing so itself.
+type gzipTransport struct {
+	next http.RoundTripper
+}
+
+func (t *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Callers asking for an encoding themselves get the body as sent.
+	if len(req.Header.Get("Accept-Encoding")) != 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", gzipEncoding)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decompressResponse(resp); err != nil {
+		closeBody(resp)
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// decompressResponse replaces the body of a gzipped response with its decompressed content.
+func decompressResponse(resp *http.Response) error {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), gzipEncoding) {
+		return nil
+	}
+
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	resp.Body = &gzipBody{Reader: reader, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return nil
+}
+
+// gzipBody closes both the gzip reader and the underlying response body.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (body *gzipBody) Close() error {
+	body.Reader.Close()
+	return body.body.Close()
+}
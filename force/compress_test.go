@@ -0,0 +1,106 @@
+package force
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzip(t *testing.T) {
+	var encodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			reader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("Unable to read gzipped request: %v", err)
+				return
+			}
+			body = reader
+		}
+		in := map[string]string{}
+		if err := json.NewDecoder(body).Decode(&in); err != nil {
+			t.Errorf("Unable to decode request: %v", err)
+		}
+
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Expected gzipped responses to be accepted, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		json.NewEncoder(writer).Encode(map[string]int{"length": len(in["Description"])})
+		writer.Close()
+	}))
+	defer server.Close()
+
+	// Interceptors see the decompressed response.
+	var intercepted []string
+	o := newOptions([]Option{
+		WithGzip(1024),
+		WithTransport(&http.Transport{DisableCompression: true}),
+		WithInterceptors(func(call *Call, next Invoker) (*http.Response, error) {
+			resp, err := next(call)
+			if err == nil {
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+				intercepted = append(intercepted, string(body))
+			}
+			return resp, err
+		}),
+	})
+	httpClient, err := o.buildHTTPClient(nil)
+	if err != nil {
+		t.Fatalf("Unable to build http client: %v", err)
+	}
+
+	forceApi := newTestForceApi(server.URL)
+	forceApi.httpClient = httpClient
+	forceApi.gzip = true
+	forceApi.gzipMinSize = 1024
+
+	for _, length := range []int{10, 4096} {
+		out := map[string]int{}
+		in := map[string]string{"Description": strings.Repeat("x", length)}
+		if err := forceApi.Post("/services/data/"+testVersion+"/sobjects/Account", nil, in, &out); err != nil {
+			t.Fatalf("Unable to post: %v", err)
+		}
+		if out["length"] != length {
+			t.Fatalf("Expected the gzipped response to be decoded, got %v", out)
+		}
+	}
+
+	if encodings[0] != "" || encodings[1] != "gzip" {
+		t.Fatalf("Expected only the large payload to be compressed, got %q", encodings)
+	}
+	if len(intercepted) != 2 || !strings.HasPrefix(intercepted[1], `{"length":4096}`) {
+		t.Fatalf("Expected interceptors to see the decompressed responses, got %q", intercepted)
+	}
+}
+
+func TestDecompressResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain"))
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unable to get: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := decompressResponse(resp); err != nil {
+		t.Fatalf("Unable to decompress: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "plain" {
+		t.Fatalf("Expected responses without Content-Encoding to be left alone, got %q", body)
+	}
+}
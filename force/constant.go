@@ -7,6 +7,9 @@ const (
 
 	grantType             string = "password"
 	grantTypeRefreshToken string = "refresh_token"
+	grantTypeJWTBearer    string = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	grantTypeClientCredentials string = "client_credentials"
 
 	limitsKey          string = "limits"
 	queryKey           string = "query"
@@ -20,6 +23,12 @@ const (
 	rowTemplateKey string = "rowTemplate"
 	idKey          string = "{ID}"
 
+	defaultAPIVersion  string = "v36.0"
+	productionLoginURI string = "https://login.salesforce.com"
+	sandboxLoginURI    string = "https://test.salesforce.com"
+	sandboxEnvironment string = "sandbox"
+	formURLEncodedType string = "application/x-www-form-urlencoded"
+
 	resourcesUri string = "/services/data/%v"
 	oauthURL     string = "/services/oauth2/token"
 
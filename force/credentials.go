@@ -0,0 +1,112 @@
+package force
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrClientCredentialsNotEnabled is returned when the connected app is not set up for the
+// client credentials flow, or has no execution user assigned.
+var ErrClientCredentialsNotEnabled = errors.New("client credentials flow is not enabled for the connected app")
+
+// WithClientCredentials authenticates with the OAuth 2.0 client credentials flow, which runs
+// as the execution user of the connected app. Salesforce only accepts this grant on the My
+// Domain URL of the org, e.g. "https://mycompany.my.salesforce.com".
+func WithClientCredentials(myDomainURL, clientId, clientSecret string) Option {
+	return func(o *options) {
+		o.flow = clientCredentialsFlow
+		o.loginURI = normalizeMyDomainURL(myDomainURL)
+		o.clientId = clientId
+		o.clientSecret = clientSecret
+	}
+}
+
+// CreateWithClientCredentials creates a ForceApi authenticated with the OAuth 2.0 client
+// credentials flow against the org's My Domain URL.
+func CreateWithClientCredentials(version, myDomainURL, clientId, clientSecret string) (*ForceApi, error) {
+	return CreateWithClientCredentialsContext(context.Background(), version, myDomainURL, clientId, clientSecret)
+}
+
+// CreateWithClientCredentialsContext is like CreateWithClientCredentials but uses ctx for the
+// token exchange and initial resource requests.
+func CreateWithClientCredentialsContext(ctx context.Context, version, myDomainURL, clientId, clientSecret string) (*ForceApi, error) {
+	return NewContext(ctx,
+		WithAPIVersion(version),
+		WithClientCredentials(myDomainURL, clientId, clientSecret),
+	)
+}
+
+func (oauth *forceOauth) AuthenticateWithClientCredentials() error {
+	return oauth.AuthenticateWithClientCredentialsContext(context.Background())
+}
+
+func (oauth *forceOauth) AuthenticateWithClientCredentialsContext(ctx context.Context) error {
+	if len(oauth.loginURI) == 0 || oauth.loginURI == productionLoginURI || oauth.loginURI == sandboxLoginURI {
+		return fmt.Errorf("client credentials flow requires the My Domain URL of the org, got %q", oauth.loginURI)
+	}
+
+	payload := url.Values{
+		"grant_type":    {grantTypeClientCredentials},
+		"client_id":     {oauth.clientId},
+		"client_secret": {oauth.clientSecret},
+	}
+
+	err := oauth.AuthenticateWithPayloadContext(ctx, payload)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && clientCredentialsNotEnabled(apiErr) {
+		return &clientCredentialsError{err: err, description: apiErr.ErrorDescription}
+	}
+
+	return err
+}
+
+// clientCredentialsError is ErrClientCredentialsNotEnabled for a token response, which it
+// unwraps to so that the status code and request id stay available.
+type clientCredentialsError struct {
+	err         error
+	description string
+}
+
+func (e *clientCredentialsError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrClientCredentialsNotEnabled, e.description)
+}
+
+func (e *clientCredentialsError) Is(target error) bool {
+	return target == ErrClientCredentialsNotEnabled
+}
+
+func (e *clientCredentialsError) Unwrap() error {
+	return e.err
+}
+
+// clientCredentialsNotEnabled reports whether the token endpoint refused the grant because
+// the connected app is not configured for it.
+func clientCredentialsNotEnabled(apiErr *APIError) bool {
+	switch apiErr.ErrorName {
+	case "unsupported_grant_type":
+		return true
+	case "invalid_grant":
+		return strings.Contains(strings.ToLower(apiErr.ErrorDescription), "client credentials")
+	}
+
+	return false
+}
+
+// normalizeMyDomainURL turns "mycompany.my.salesforce.com" or "https://mycompany.my.salesforce.com/"
+// into "https://mycompany.my.salesforce.com".
+func normalizeMyDomainURL(myDomainURL string) string {
+	myDomainURL = strings.TrimSpace(myDomainURL)
+	if len(myDomainURL) == 0 {
+		return ""
+	}
+
+	if !strings.Contains(myDomainURL, "://") {
+		myDomainURL = "https://" + myDomainURL
+	}
+
+	return strings.TrimRight(myDomainURL, "/")
+}
@@ -0,0 +1,68 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestNormalizeMyDomainURL(t *testing.T) {
+	tests := map[string]string{
+		"mycompany.my.salesforce.com":          "https://mycompany.my.salesforce.com",
+		"https://mycompany.my.salesforce.com/": "https://mycompany.my.salesforce.com",
+		" http://localhost:8080 ":              "http://localhost:8080",
+		"":                                     "",
+	}
+
+	for in, expected := range tests {
+		if got := normalizeMyDomainURL(in); got != expected {
+			t.Errorf("normalizeMyDomainURL(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+func TestCreateWithClientCredentials(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.token = func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != grantTypeClientCredentials || r.FormValue("client_secret") != testClientSecret {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_client","error_description":"invalid client credentials"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"cc-token","instance_url":"%s"}`, fake.URL)
+	}
+
+	forceApi, err := CreateWithClientCredentials(testVersion, fake.URL+"/", testClientId, testClientSecret)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+	if forceApi.GetAccessToken() != "cc-token" {
+		t.Fatalf("Unexpected access token: %v", forceApi.GetAccessToken())
+	}
+}
+
+func TestClientCredentialsNotEnabled(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.token = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_grant","error_description":"no client credentials user enabled"}`)
+	}
+
+	_, err := CreateWithClientCredentials(testVersion, fake.URL, testClientId, testClientSecret)
+	if !errors.Is(err, ErrClientCredentialsNotEnabled) {
+		t.Fatalf("Expected ErrClientCredentialsNotEnabled, got: %v", err)
+	}
+
+	var forceErr *Error
+	if !errors.As(err, &forceErr) || forceErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected the error to unwrap to the token response, got: %v", err)
+	}
+}
+
+func TestClientCredentialsRequiresMyDomain(t *testing.T) {
+	_, err := CreateWithClientCredentials(testVersion, "https://login.salesforce.com", testClientId, testClientSecret)
+	if err == nil {
+		t.Fatal("Expected an error without a My Domain URL")
+	}
+}
@@ -0,0 +1,58 @@
+package force
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// Request is a raw request to any Salesforce endpoint, for resources this package does
+// not wrap yet.
+type Request struct {
+	Method string
+
+	// Path is relative to the instance URL, e.g. "/services/data/v36.0/limits", or an
+	// absolute URL on the instance or identity host, such as the identity URL of the
+	// session. Absolute URLs on other hosts are rejected with ErrUntrustedURL.
+	Path   string
+	Params url.Values
+
+	// Header is added to the headers set by the ForceApi. Content-Type and Accept default
+	// to JSON.
+	Header http.Header
+
+	// Body is kept in memory so that the request can be retried and resent after the
+	// session is renewed.
+	Body []byte
+}
+
+// Response is the response to a Request. The caller must close Body.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+}
+
+// Do sends req with the session of the ForceApi, renewing the session and retrying
+// transient failures like any other request. For a status of 400 and above, Do returns
+// the response along with an *Error; its body can still be read.
+func (forceApi *ForceApi) Do(ctx context.Context, req *Request) (*Response, error) {
+	resp, respBytes, err := forceApi.do(ctx, req.Method, req.Path, req.Params, req.Header, req.Body, true)
+	if resp == nil {
+		return nil, err
+	}
+
+	body := resp.Body
+	if respBytes != nil || resp.StatusCode >= http.StatusBadRequest {
+		body = ioutil.NopCloser(bytes.NewReader(respBytes))
+	}
+
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}, err
+}
@@ -0,0 +1,121 @@
+package force
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestDo(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc("/services/data/"+testVersion+"/new-resource", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" || r.URL.Query().Get("mode") != "test" || string(body) != "<xml/>" {
+			t.Errorf("Unexpected request: %v %v %q", r.Method, r.URL, body)
+		}
+		if r.Header.Get("Content-Type") != "application/xml" || r.Header.Get("Authorization") != "Bearer test-access-token" {
+			t.Errorf("Unexpected headers: %v", r.Header)
+		}
+		w.Header().Set("Location", "/services/data/"+testVersion+"/new-resource/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`created`))
+	})
+
+	forceApi := newTestForceApi(fake.URL)
+
+	resp, err := forceApi.Do(context.Background(), &Request{
+		Method: "POST",
+		Path:   "/services/data/" + testVersion + "/new-resource",
+		Params: url.Values{"mode": {"test"}},
+		Header: http.Header{"Content-Type": {"application/xml"}},
+		Body:   []byte("<xml/>"),
+	})
+	if err != nil {
+		t.Fatalf("Unable to do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") == "" || string(body) != "created" {
+		t.Fatalf("Unexpected response: %v %v %q", resp.StatusCode, resp.Header, body)
+	}
+}
+
+func TestDoError(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc("/services/data/"+testVersion+"/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`[{"errorCode":"NOT_FOUND","message":"The requested resource does not exist"}]`))
+	})
+
+	forceApi := newTestForceApi(fake.URL)
+
+	resp, err := forceApi.Do(context.Background(), &Request{Method: "GET", Path: "/services/data/" + testVersion + "/missing"})
+	if !IsNotFound(err) {
+		t.Fatalf("Expected a not found error, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusNotFound || len(body) == 0 {
+		t.Fatalf("Expected the failed response to be returned, got %v %q", resp.StatusCode, body)
+	}
+}
+
+func TestDoRenewsSession(t *testing.T) {
+	fake := newFakeForce(t)
+	var calls int32
+	handleSession(fake, "/data", "stale", &calls)
+
+	forceApi := newTestForceApi(fake.URL)
+	forceApi.oauth.loginURI = fake.URL
+	forceApi.oauth.flow = refreshTokenFlow
+	forceApi.oauth.AccessToken = "stale"
+
+	resp, err := forceApi.Do(context.Background(), &Request{Method: "GET", Path: "/data"})
+	if err != nil {
+		t.Fatalf("Unable to do request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || calls != 2 {
+		t.Fatalf("Expected the request to be sent again after renewing the session, got %v after %v calls",
+			resp.StatusCode, calls)
+	}
+}
+
+func TestDoWithoutSession(t *testing.T) {
+	forceApi := newTestForceApi("")
+	forceApi.oauth.AccessToken = ""
+
+	resp, err := forceApi.Do(context.Background(), &Request{Method: "GET", Path: "/data"})
+	if resp != nil || err == nil {
+		t.Fatalf("Expected the request to fail before being sent, got %v, %v", resp, err)
+	}
+}
+
+func TestDoAbsoluteURL(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc("/id/00D/005", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	other := newFakeForce(t)
+	other.mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("The session was sent to another host: %v", r.Header.Get("Authorization"))
+	})
+
+	forceApi := newTestForceApi(fake.URL)
+
+	resp, err := forceApi.Do(context.Background(), &Request{Method: "GET", Path: fake.URL + "/id/00D/005"})
+	if err != nil {
+		t.Fatalf("Expected absolute URLs on the instance host to be allowed: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := forceApi.QueryNext(other.URL+"/data", &map[string]interface{}{}); !errors.Is(err, ErrUntrustedURL) {
+		t.Fatalf("Expected ErrUntrustedURL, got %v", err)
+	}
+}
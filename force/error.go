@@ -1,10 +1,36 @@
 package force
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+
+	"github.com/dewisuryani/go-force/forcejson"
+)
+
+// Salesforce error codes checked by the Is* helpers.
+const (
+	notFoundErrorCode            string = "NOT_FOUND"
+	duplicateValueErrorCode      string = "DUPLICATE_VALUE"
+	duplicatesDetectedErrorCode  string = "DUPLICATES_DETECTED"
+	duplicateExternalIdErrorCode string = "DUPLICATE_EXTERNAL_ID"
 )
 
+// Salesforce has reported the id of a request under several header names.
+var requestIdHeaders = []string{"Sforce-Request-Id", "X-Request-Id", "X-Sfdc-Request-Id"}
+
+// Error is returned for every request that force.com answers with an error status.
+// It unwraps to the APIErrors from the response body.
+type Error struct {
+	StatusCode int
+	Method     string
+	Path       string
+	RequestId  string
+	Errors     APIErrors
+}
+
 // Custom Error to handle salesforce api responses.
 type APIErrors []*APIError
 
@@ -26,7 +52,7 @@ func (e APIErrors) String() string {
 		s[i] = err.String()
 	}
 
-	return strings.Join(s, "\n")
+	return strings.Join(s, "; ")
 }
 
 func (e APIErrors) Validate() bool {
@@ -42,7 +68,21 @@ func (e APIError) Error() string {
 }
 
 func (e APIError) String() string {
-	return fmt.Sprintf("%#v", e)
+	var s string
+	switch {
+	case len(e.ErrorCode) != 0:
+		s = e.ErrorCode + ": " + e.Message
+	case len(e.ErrorName) != 0:
+		s = e.ErrorName + ": " + e.ErrorDescription
+	default:
+		s = e.Message
+	}
+
+	if len(e.Fields) != 0 {
+		s += fmt.Sprintf(" (fields: %v)", strings.Join(e.Fields, ", "))
+	}
+
+	return s
 }
 
 func (e APIError) Validate() bool {
@@ -52,3 +92,149 @@ func (e APIError) Validate() bool {
 
 	return false
 }
+
+var errSessionNotRenewable = errors.New("the session was created from an access token and has no credentials to renew it")
+
+// SessionError is returned when an expired session cannot be renewed, either because
+// authenticating again failed or because the renewed session was rejected as well.
+type SessionError struct {
+	Err error
+}
+
+func (e *SessionError) Error() string {
+	return fmt.Sprintf("unable to renew force.com session: %v", e.Err)
+}
+
+func (e *SessionError) Unwrap() error {
+	return e.Err
+}
+
+// newError builds the Error for a failed response. The body is parsed as a list of REST
+// API errors, or as a single OAuth error.
+func newError(method, path string, resp *http.Response, respBytes []byte) *Error {
+	forceErr := &Error{
+		StatusCode: resp.StatusCode,
+		Method:     method,
+		Path:       path,
+		Errors:     ParseAPIErrors(respBytes),
+	}
+
+	for _, header := range requestIdHeaders {
+		if id := resp.Header.Get(header); len(id) != 0 {
+			forceErr.RequestId = id
+			break
+		}
+	}
+
+	return forceErr
+}
+
+// ParseAPIErrors decodes the body of a failed response, given either as a list of REST
+// API errors or as a single OAuth error. It returns nil for any other body.
+func ParseAPIErrors(respBytes []byte) APIErrors {
+	apiErrors := APIErrors{}
+	if err := forcejson.Unmarshal(respBytes, &apiErrors); err == nil && apiErrors.Validate() {
+		return apiErrors
+	}
+
+	apiError := &APIError{}
+	if err := json.Unmarshal(respBytes, apiError); err == nil && apiError.Validate() {
+		return APIErrors{apiError}
+	}
+
+	return nil
+}
+
+func (e *Error) Error() string {
+	s := fmt.Sprintf("%v %v: %v %v", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Errors.Validate() {
+		s += ": " + e.Errors.String()
+	}
+	if len(e.RequestId) != 0 {
+		s += " (request id " + e.RequestId + ")"
+	}
+
+	return s
+}
+
+func (e *Error) Unwrap() error {
+	if !e.Errors.Validate() {
+		return nil
+	}
+
+	return e.Errors
+}
+
+// As lets errors.As find the first APIError of the response.
+func (e *Error) As(target interface{}) bool {
+	if apiErr, ok := target.(**APIError); ok && e.Errors.Validate() {
+		*apiErr = e.Errors[0]
+		return true
+	}
+
+	return false
+}
+
+// ErrorCodes returns the Salesforce error codes of the response, e.g. "NOT_FOUND".
+func (e *Error) ErrorCodes() []string {
+	codes := make([]string, 0, len(e.Errors))
+	for _, apiErr := range e.Errors {
+		if len(apiErr.ErrorCode) != 0 {
+			codes = append(codes, apiErr.ErrorCode)
+		} else if len(apiErr.ErrorName) != 0 {
+			codes = append(codes, apiErr.ErrorName)
+		}
+	}
+
+	return codes
+}
+
+// Fields returns the fields the errors of the response relate to.
+func (e *Error) Fields() []string {
+	var fields []string
+	for _, apiErr := range e.Errors {
+		fields = append(fields, apiErr.Fields...)
+	}
+
+	return fields
+}
+
+// HasErrorCode reports whether any error of the response has one of the given codes.
+func (e *Error) HasErrorCode(codes ...string) bool {
+	for _, errorCode := range e.ErrorCodes() {
+		for _, code := range codes {
+			if errorCode == code {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsNotFound reports whether err is a force.com error for a record or resource that does not exist.
+func IsNotFound(err error) bool {
+	var forceErr *Error
+	return errors.As(err, &forceErr) &&
+		(forceErr.StatusCode == http.StatusNotFound || forceErr.HasErrorCode(notFoundErrorCode))
+}
+
+// IsDuplicate reports whether err is a force.com error for a duplicate value or record.
+func IsDuplicate(err error) bool {
+	var forceErr *Error
+	return errors.As(err, &forceErr) &&
+		forceErr.HasErrorCode(duplicateValueErrorCode, duplicatesDetectedErrorCode, duplicateExternalIdErrorCode)
+}
+
+// IsRowLock reports whether err is a force.com error for a record locked by another transaction.
+func IsRowLock(err error) bool {
+	var forceErr *Error
+	return errors.As(err, &forceErr) && forceErr.HasErrorCode(unableToLockRowErrorCode)
+}
+
+// IsLimitExceeded reports whether err is a force.com error for an exceeded API request limit.
+func IsLimitExceeded(err error) bool {
+	var forceErr *Error
+	return errors.As(err, &forceErr) &&
+		(forceErr.StatusCode == http.StatusTooManyRequests || forceErr.HasErrorCode(requestLimitExceededErrorCode))
+}
@@ -0,0 +1,100 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestErrorFromResponse(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc("/services/data/v36.0/sobjects/Account/001", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Sforce-Request-Id", "req-1")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `[{"errorCode":"NOT_FOUND","message":"The requested resource does not exist"}]`)
+	})
+	fake.mux.HandleFunc("/services/data/v36.0/sobjects/Account", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `[{"errorCode":"DUPLICATE_VALUE","message":"duplicate value found","fields":["External__c"]}]`)
+	})
+
+	forceApi := newTestForceApi(fake.URL)
+
+	err := forceApi.Get("/services/data/v36.0/sobjects/Account/001", nil, &map[string]interface{}{})
+	var forceErr *Error
+	if !errors.As(err, &forceErr) {
+		t.Fatalf("Expected a *Error, got %T: %v", err, err)
+	}
+	if forceErr.StatusCode != http.StatusNotFound || forceErr.Method != "GET" || forceErr.RequestId != "req-1" ||
+		forceErr.Path != "/services/data/v36.0/sobjects/Account/001" {
+		t.Fatalf("Unexpected error: %#v", forceErr)
+	}
+	if !IsNotFound(err) || IsDuplicate(err) || IsRowLock(err) || IsLimitExceeded(err) {
+		t.Fatalf("Unexpected classification of %v", err)
+	}
+	if !strings.Contains(err.Error(), "NOT_FOUND: The requested resource does not exist") {
+		t.Fatalf("Unexpected error message: %v", err)
+	}
+
+	// Callers that used to match on APIErrors keep working.
+	var apiErrors APIErrors
+	if !errors.As(err, &apiErrors) || apiErrors[0].ErrorCode != "NOT_FOUND" {
+		t.Fatalf("Expected the error to unwrap to APIErrors, got %v", apiErrors)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode != "NOT_FOUND" {
+		t.Fatalf("Expected the error to unwrap to an APIError, got %v", apiErr)
+	}
+
+	err = forceApi.Post("/services/data/v36.0/sobjects/Account", nil, map[string]string{"Name": "x"}, &SObjectResponse{})
+	if !IsDuplicate(err) {
+		t.Fatalf("Expected a duplicate error, got %v", err)
+	}
+	if !errors.As(err, &forceErr) || len(forceErr.Fields()) != 1 || forceErr.Fields()[0] != "External__c" {
+		t.Fatalf("Unexpected fields for %v", err)
+	}
+
+	// The helpers see through wrapping.
+	if !IsDuplicate(fmt.Errorf("insert account: %w", err)) {
+		t.Fatal("Expected IsDuplicate to unwrap wrapped errors")
+	}
+}
+
+func TestErrorHelpers(t *testing.T) {
+	tests := []struct {
+		err      *Error
+		check    func(error) bool
+		expected bool
+	}{
+		{&Error{StatusCode: http.StatusBadRequest, Errors: APIErrors{{ErrorCode: "UNABLE_TO_LOCK_ROW"}}}, IsRowLock, true},
+		{&Error{StatusCode: http.StatusForbidden, Errors: APIErrors{{ErrorCode: "REQUEST_LIMIT_EXCEEDED"}}}, IsLimitExceeded, true},
+		{&Error{StatusCode: http.StatusTooManyRequests}, IsLimitExceeded, true},
+		{&Error{StatusCode: http.StatusNotFound}, IsNotFound, true},
+		{&Error{StatusCode: http.StatusBadRequest, Errors: APIErrors{{ErrorCode: "DUPLICATES_DETECTED"}}}, IsDuplicate, true},
+		{&Error{StatusCode: http.StatusBadRequest, Errors: APIErrors{{ErrorCode: "FIELD_CUSTOM_VALIDATION_EXCEPTION"}}}, IsDuplicate, false},
+	}
+
+	for _, test := range tests {
+		if got := test.check(test.err); got != test.expected {
+			t.Errorf("Unexpected classification of %v: %v", test.err, got)
+		}
+	}
+
+	if IsNotFound(errors.New("not a force error")) || IsNotFound(nil) {
+		t.Fatal("Only force.com errors can be classified")
+	}
+}
+
+func TestAPIErrorString(t *testing.T) {
+	apiErr := APIError{ErrorCode: "REQUIRED_FIELD_MISSING", Message: "Required fields are missing", Fields: []string{"Name"}}
+	if apiErr.String() != "REQUIRED_FIELD_MISSING: Required fields are missing (fields: Name)" {
+		t.Fatalf("Unexpected string: %v", apiErr.String())
+	}
+
+	oauthErr := APIError{ErrorName: "invalid_grant", ErrorDescription: "authentication failure"}
+	if oauthErr.String() != "invalid_grant: authentication failure" {
+		t.Fatalf("Unexpected string: %v", oauthErr.String())
+	}
+}
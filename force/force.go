@@ -4,126 +4,164 @@
 package force
 
 import (
+	"context"
 	"fmt"
 	"os"
-
-	"github.com/sirupsen/logrus"
-	"github.com/ztrue/tracerr"
 )
 
-func Create(version, uri, clientId, clientSecret, userName, password,
-	securityToken, environment string) (*ForceApi, error) {
-	oauth := &forceOauth{
-		loginURI:      uri,
-		clientId:      clientId,
-		clientSecret:  clientSecret,
-		userName:      userName,
-		password:      password,
-		securityToken: securityToken,
-		environment:   environment,
-	}
+// New creates a ForceApi configured by opts. The OAuth flow is chosen by the
+// last credentials option given and defaults to the username-password flow.
+func New(opts ...Option) (*ForceApi, error) {
+	return NewContext(context.Background(), opts...)
+}
 
-	forceApi := &ForceApi{
-		apiResources:           make(map[string]string),
-		apiSObjects:            make(map[string]*SObjectMetaData),
-		apiSObjectDescriptions: make(map[string]*SObjectDescription),
-		apiVersion:             version,
-		oauth:                  oauth,
-	}
+// NewContext is like New but uses ctx for the login and initial resource requests.
+func NewContext(ctx context.Context, opts ...Option) (*ForceApi, error) {
+	o := newOptions(opts)
 
-	// Init oauth
-	err := forceApi.oauth.Authenticate()
+	forceApi, err := newForceApi(o)
 	if err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"oauth":    oauth,
-			"forceApi": forceApi,
-			"err":      err,
-		}).Error("error oauth authenticate on create")
 		return nil, err
 	}
+	oauth := forceApi.oauth
+
+	switch {
+	case o.flow == accessTokenFlow:
+		// We need to check for oath correctness here, since we are not generating the token ourselves.
+		if err := forceApi.oauth.Validate(); err != nil {
+			forceApi.log.error("error oauth validate on create with access token",
+				"instanceUrl", oauth.InstanceUrl,
+				"err", err)
+			return nil, err
+		}
+	case forceApi.oauth.loadSession(ctx):
+		// Reuse the shared session, it is renewed on the first request if it has expired.
+	default:
+		if err := forceApi.oauth.authenticate(ctx); err != nil {
+			forceApi.log.error("error oauth authenticate on create",
+				"loginURI", oauth.loginURI,
+				"clientId", oauth.clientId,
+				"userName", oauth.userName,
+				"err", err)
+			return nil, err
+		}
+	}
 
-	return initAPIResources(forceApi)
+	return initAPIResources(ctx, forceApi)
 }
 
-func CreateWithAccessToken(version, clientId, accessToken, instanceUrl string) (*ForceApi, error) {
-	oauth := &forceOauth{
-		clientId:    clientId,
-		AccessToken: accessToken,
-		InstanceUrl: instanceUrl,
-	}
+// newForceApi builds an unauthenticated ForceApi from o.
+func newForceApi(o *options) (*ForceApi, error) {
+	log := newForceLogger(o.logger, o.redactedFields)
 
-	forceApi := &ForceApi{
-		apiResources:           make(map[string]string),
-		apiSObjects:            make(map[string]*SObjectMetaData),
-		apiSObjectDescriptions: make(map[string]*SObjectDescription),
-		apiVersion:             version,
-		oauth:                  oauth,
-	}
+	limiter := newRateLimiter(o.rateLimits, o.onRateLimitWait)
 
-	// We need to check for oath correctness here, since we are not generating the token ourselves.
-	if err := forceApi.oauth.Validate(); err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"oauth":    oauth,
-			"forceApi": forceApi,
-			"err":      err,
-		}).Error("error oauth validate on create with access token")
+	httpClient, err := o.buildHTTPClient(limiter)
+	if err != nil {
+		log.error("error build http client on create", "err", err)
 		return nil, err
 	}
 
-	return initAPIResources(forceApi)
-}
-
-func CreateWithRefreshToken(version, clientId, clientSecret, refreshToken, environment string) (*ForceApi, error) {
 	oauth := &forceOauth{
-		clientId:     clientId,
-		clientSecret: clientSecret,
-		refreshToken: refreshToken,
-		environment:  environment,
+		AccessToken: o.accessToken,
+		InstanceUrl: o.instanceUrl,
+
+		loginURI:      o.loginURI,
+		clientId:      o.clientId,
+		clientSecret:  o.clientSecret,
+		refreshToken:  o.refreshToken,
+		userName:      o.userName,
+		password:      o.password,
+		securityToken: o.securityToken,
+		environment:   o.environment,
+		privateKeyPEM: o.privateKeyPEM,
+		httpClient:    httpClient,
+		userAgent:     o.userAgent,
+		flow:          o.flow,
+		store:         o.tokenStore,
+		storeKey:      o.tokenStoreKey,
+		log:           log,
+	}
+	if len(oauth.storeKey) == 0 {
+		oauth.storeKey = oauth.defaultTokenStoreKey()
 	}
 
 	forceApi := &ForceApi{
 		apiResources:           make(map[string]string),
 		apiSObjects:            make(map[string]*SObjectMetaData),
 		apiSObjectDescriptions: make(map[string]*SObjectDescription),
-		apiVersion:             version,
+		apiVersion:             o.apiVersion,
 		oauth:                  oauth,
+		httpClient:             httpClient,
+		userAgent:              o.userAgent,
+		retryPolicy:            o.retryPolicy,
+		usage:                  newUsageTracker(o),
+		limiter:                limiter,
+		gzip:                   o.gzip,
+		gzipMinSize:            o.gzipMinSize,
+		onStreamError:          o.onStreamError,
+		replayStore:            o.replayStore,
+		streamWorkers:          o.streamWorkers,
+		log:                    log,
 	}
 
-	// Init oauth
-	if err := forceApi.oauth.AuthenticateWithRefreshToken(); err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"oauth":    oauth,
-			"forceApi": forceApi,
-			"err":      err,
-		}).Error("error oauth authenticate with refresh token")
-		return nil, err
-	}
+	return forceApi, nil
+}
+
+func Create(version, uri, clientId, clientSecret, userName, password,
+	securityToken, environment string) (*ForceApi, error) {
+	return CreateContext(context.Background(), version, uri, clientId, clientSecret, userName, password,
+		securityToken, environment)
+}
+
+// CreateContext is like Create but uses ctx for the login and initial resource requests.
+func CreateContext(ctx context.Context, version, uri, clientId, clientSecret, userName, password,
+	securityToken, environment string) (*ForceApi, error) {
+	return NewContext(ctx,
+		WithAPIVersion(version),
+		WithLoginURL(uri),
+		WithEnvironment(environment),
+		WithPasswordCredentials(clientId, clientSecret, userName, password, securityToken),
+	)
+}
+
+func CreateWithAccessToken(version, clientId, accessToken, instanceUrl string) (*ForceApi, error) {
+	return CreateWithAccessTokenContext(context.Background(), version, clientId, accessToken, instanceUrl)
+}
+
+// CreateWithAccessTokenContext is like CreateWithAccessToken but uses ctx for the initial resource requests.
+func CreateWithAccessTokenContext(ctx context.Context, version, clientId, accessToken, instanceUrl string) (*ForceApi, error) {
+	return NewContext(ctx,
+		WithAPIVersion(version),
+		WithAccessToken(clientId, accessToken, instanceUrl),
+	)
+}
+
+func CreateWithRefreshToken(version, clientId, clientSecret, refreshToken, environment string) (*ForceApi, error) {
+	return CreateWithRefreshTokenContext(context.Background(), version, clientId, clientSecret, refreshToken, environment)
+}
 
-	return initAPIResources(forceApi)
+// CreateWithRefreshTokenContext is like CreateWithRefreshToken but uses ctx for the token exchange and
+// initial resource requests.
+func CreateWithRefreshTokenContext(ctx context.Context, version, clientId, clientSecret, refreshToken, environment string) (*ForceApi, error) {
+	return NewContext(ctx,
+		WithAPIVersion(version),
+		WithEnvironment(environment),
+		WithRefreshToken(clientId, clientSecret, refreshToken),
+	)
 }
 
-func initAPIResources(forceApi *ForceApi) (*ForceApi, error) {
+func initAPIResources(ctx context.Context, forceApi *ForceApi) (*ForceApi, error) {
 	// Init Api Resources
-	err := forceApi.getApiResources()
+	err := forceApi.getApiResources(ctx)
 	if err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"forceApi": forceApi,
-			"err":      err,
-		}).Error("error get api resources")
+		forceApi.log.error("error get api resources", "err", err)
 		return nil, err
 	}
 
-	err = forceApi.getApiSObjects()
+	err = forceApi.getApiSObjects(ctx)
 	if err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"forceApi": forceApi,
-			"err":      err,
-		}).Error("error get api sobjects")
+		forceApi.log.error("error get api sobjects", "err", err)
 		return nil, err
 	}
 
@@ -134,7 +172,7 @@ func initAPIResources(forceApi *ForceApi) (*ForceApi, error) {
 func createTest() *ForceApi {
 	forceApi, err := Create(testVersion, testLoginURI, testClientId, testClientSecret, testUserName, testPassword, testSecurityToken, testEnvironment)
 	if err != nil {
-		logrus.WithField("err", tracerr.Wrap(err)).Error("unable to create force api for test")
+		fmt.Fprintf(os.Stderr, "unable to create force api for test: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -151,6 +189,8 @@ type ForceApiLogger interface {
 // logged strings, which can aid in filtering log lines.
 //
 // Use TraceOn if you want to spy on the ForceApi requests and responses.
+// Authorization headers, cookies and redacted query parameters are masked,
+// but response bodies are traced as is. Use WithLogger for structured logs.
 //
 // Note that the base log.Logger type satisfies ForceApiLogger, but adapters
 // can easily be written for other logging packages (e.g., the
@@ -0,0 +1,159 @@
+package force
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	revokeURL     string = "/services/oauth2/revoke"
+	introspectURL string = "/services/oauth2/introspect"
+)
+
+// Identity describes the user and org a session belongs to, as returned by the identity URL.
+type Identity struct {
+	Id               string            `json:"id"`
+	AssertedUser     bool              `json:"asserted_user"`
+	UserId           string            `json:"user_id"`
+	OrganizationId   string            `json:"organization_id"`
+	Username         string            `json:"username"`
+	NickName         string            `json:"nick_name"`
+	DisplayName      string            `json:"display_name"`
+	Email            string            `json:"email"`
+	EmailVerified    bool              `json:"email_verified"`
+	FirstName        string            `json:"first_name"`
+	LastName         string            `json:"last_name"`
+	Timezone         string            `json:"timezone"`
+	Photos           map[string]string `json:"photos"`
+	Status           *IdentityStatus   `json:"status"`
+	URLs             map[string]string `json:"urls"`
+	Active           bool              `json:"active"`
+	UserType         string            `json:"user_type"`
+	Language         string            `json:"language"`
+	Locale           string            `json:"locale"`
+	UTCOffset        int64             `json:"utcOffset"`
+	LastModifiedDate string            `json:"last_modified_date"`
+	IsAppInstalled   bool              `json:"is_app_installed"`
+}
+
+type IdentityStatus struct {
+	CreatedDate string `json:"created_date"`
+	Body        string `json:"body"`
+}
+
+// TokenIntrospection is the state of a token as reported by the introspection endpoint.
+// Only Active is set for tokens that are expired or revoked.
+type TokenIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope"`
+	ClientId  string `json:"client_id"`
+	Username  string `json:"username"`
+	Subject   string `json:"sub"`
+	TokenType string `json:"token_type"`
+	Audience  string `json:"aud"`
+	Issuer    string `json:"iss"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// Revoke revokes the session on Salesforce. When the ForceApi holds a refresh token, it is
+// revoked along with every access token issued from it. The ForceApi cannot be used afterwards.
+func (forceApi *ForceApi) Revoke() error {
+	return forceApi.RevokeContext(context.Background())
+}
+
+// RevokeContext is like Revoke but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) RevokeContext(ctx context.Context) error {
+	oauth := forceApi.oauth
+
+	oauth.mu.RLock()
+	token := oauth.AccessToken
+	if len(oauth.refreshToken) != 0 {
+		token = oauth.refreshToken
+	}
+	oauth.mu.RUnlock()
+
+	if _, err := oauth.postForm(ctx, "revoke", revokeURL, url.Values{"token": {token}}); err != nil {
+		oauth.log.error("error revoke token", "err", err)
+		return err
+	}
+
+	if oauth.store != nil {
+		if err := oauth.store.Invalidate(ctx, oauth.storeKey); err != nil {
+			oauth.log.error("error invalidate stored token", "key", oauth.storeKey, "err", err)
+		}
+	}
+	oauth.setSession(&Token{})
+
+	return nil
+}
+
+// Introspect reports whether the current access token is still active, and for whom and
+// until when it was issued. It requires the client secret of the connected app.
+func (forceApi *ForceApi) Introspect() (*TokenIntrospection, error) {
+	return forceApi.IntrospectContext(context.Background())
+}
+
+// IntrospectContext is like Introspect but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) IntrospectContext(ctx context.Context) (*TokenIntrospection, error) {
+	oauth := forceApi.oauth
+	accessToken, _ := oauth.session()
+
+	payload := url.Values{
+		"token":           {accessToken},
+		"token_type_hint": {"access_token"},
+		"client_id":       {oauth.clientId},
+		"client_secret":   {oauth.clientSecret},
+	}
+
+	respBytes, err := oauth.postForm(ctx, "introspect", introspectURL, payload)
+	if err != nil {
+		oauth.log.error("error introspect token", "err", err)
+		return nil, err
+	}
+
+	introspection := &TokenIntrospection{}
+	if err := json.Unmarshal(respBytes, introspection); err != nil {
+		return nil, err
+	}
+
+	return introspection, nil
+}
+
+// Identity returns the user and org the session belongs to.
+func (forceApi *ForceApi) Identity() (*Identity, error) {
+	return forceApi.IdentityContext(context.Background())
+}
+
+// IdentityContext is like Identity but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) IdentityContext(ctx context.Context) (*Identity, error) {
+	identityURL := forceApi.oauth.identityURL()
+	if len(identityURL) == 0 {
+		return nil, errors.New("the session has no identity url")
+	}
+
+	ctx = withOperation(ctx, "identity", "")
+	resp, _, err := forceApi.do(ctx, "GET", identityURL, nil, nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+
+	identity := &Identity{}
+	if err := json.NewDecoder(resp.Body).Decode(identity); err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// badOAuthToken reports whether the identity endpoint rejected the access token, which it
+// answers with a plain-text 403 rather than INVALID_SESSION_ID.
+func badOAuthToken(resp *http.Response, respBytes []byte) bool {
+	return resp.StatusCode == http.StatusForbidden && strings.TrimSpace(string(respBytes)) == "Bad_OAuth_Token"
+}
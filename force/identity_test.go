@@ -0,0 +1,121 @@
+package force
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestIdentity(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc("/id/00D/005", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "Bad_OAuth_Token")
+			return
+		}
+		fmt.Fprint(w, `{"id":"id-url","user_id":"005","organization_id":"00D","username":"go-force@jalali.net",
+			"active":true,"urls":{"rest":"https://na1.salesforce.com/services/data/v{version}/"}}`)
+	})
+
+	forceApi, err := New(
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	identity, err := forceApi.Identity()
+	if err != nil {
+		t.Fatalf("Unable to get identity: %v", err)
+	}
+	if identity.UserId != "005" || identity.OrganizationId != "00D" || identity.Username != testUserName ||
+		!identity.Active || len(identity.URLs["rest"]) == 0 {
+		t.Fatalf("Unexpected identity: %+v", identity)
+	}
+}
+
+func TestIdentityRenewsSession(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc("/id/00D/005", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "Bad_OAuth_Token")
+			return
+		}
+		fmt.Fprint(w, `{"user_id":"005"}`)
+	})
+
+	forceApi := newTestForceApi(fake.URL)
+	forceApi.oauth.loginURI = fake.URL
+	forceApi.oauth.flow = refreshTokenFlow
+	forceApi.oauth.Id = fake.URL + "/id/00D/005"
+
+	identity, err := forceApi.Identity()
+	if err != nil {
+		t.Fatalf("Expected the session to be renewed: %v", err)
+	}
+	if identity.UserId != "005" || fake.tokenRequests != 1 {
+		t.Fatalf("Unexpected identity %+v after %v logins", identity, fake.tokenRequests)
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc(introspectURL, func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("token") != "token-1" || r.FormValue("client_secret") != testClientSecret {
+			fmt.Fprint(w, `{"active":false}`)
+			return
+		}
+		fmt.Fprint(w, `{"active":true,"scope":"api","client_id":"client","username":"go-force@jalali.net","exp":1600003600}`)
+	})
+
+	forceApi, err := New(
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	introspection, err := forceApi.Introspect()
+	if err != nil {
+		t.Fatalf("Unable to introspect token: %v", err)
+	}
+	if !introspection.Active || introspection.Username != testUserName || introspection.ExpiresAt != 1600003600 {
+		t.Fatalf("Unexpected introspection: %+v", introspection)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	fake := newFakeForce(t)
+	var revoked string
+	fake.mux.HandleFunc(revokeURL, func(w http.ResponseWriter, r *http.Request) {
+		revoked = r.FormValue("token")
+	})
+
+	store := NewMemoryTokenStore()
+	forceApi, err := New(
+		WithLoginURL(fake.URL),
+		WithRefreshToken(testClientId, testClientSecret, "refresh"),
+		WithTokenStore(store, "key"),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	if err := forceApi.Revoke(); err != nil {
+		t.Fatalf("Unable to revoke: %v", err)
+	}
+	if revoked != "refresh" {
+		t.Fatalf("Expected the refresh token to be revoked, got %q", revoked)
+	}
+	if forceApi.GetAccessToken() != "" {
+		t.Fatal("Expected the session to be cleared")
+	}
+	if _, err := store.Load(context.Background(), "key"); err != ErrTokenNotFound {
+		t.Fatalf("Expected the stored session to be invalidated, got: %v", err)
+	}
+}
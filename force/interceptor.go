@@ -0,0 +1,206 @@
+package force
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// CallKind tells which part of Salesforce an outgoing call goes to.
+type CallKind int
+
+const (
+	RESTCall CallKind = iota
+	OAuthCall
+	StreamingCall
+	BulkCall
+)
+
+func (kind CallKind) String() string {
+	switch kind {
+	case OAuthCall:
+		return "oauth"
+	case StreamingCall:
+		return "streaming"
+	case BulkCall:
+		return "bulk"
+	}
+
+	return "rest"
+}
+
+// Call is an outgoing call passing through the interceptor chain. Interceptors may change
+// or replace Request; it is a copy of the request built by the ForceApi.
+type Call struct {
+	Kind CallKind
+
+	// Operation names what the call does, e.g. "insert", "query", "queryMore" or "describe"
+	// for REST calls, the grant type or "renew" for OAuth calls, and the Bayeux meta channel
+	// such as "handshake" or "connect" for streaming calls. It is empty for raw requests
+	// made with Get, Post and the like.
+	Operation string
+
+	// SObject is the API name of the sObject the call operates on, if any.
+	SObject string
+
+	// Attempt counts the attempts of a retried REST call, starting at 1.
+	Attempt int
+
+	Request *http.Request
+}
+
+// Invoker sends a call on to the next interceptor, and finally to Salesforce.
+type Invoker func(call *Call) (*http.Response, error)
+
+// Interceptor wraps every HTTP request a ForceApi sends, including OAuth exchanges and
+// streaming long polls. It can change the call before passing it to next, inspect or
+// replace the response, or answer the call itself without calling next. Retried requests
+// pass through the chain once per attempt.
+type Interceptor func(call *Call, next Invoker) (*http.Response, error)
+
+// WithInterceptors adds interceptors to the chain. The first interceptor given is the
+// outermost one, so it sees the call first and the response last.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+type callKey struct{}
+
+// callFrom returns the description of the call made with ctx, without its request.
+func callFrom(ctx context.Context) Call {
+	call, _ := ctx.Value(callKey{}).(Call)
+	return call
+}
+
+// withCallKind marks the requests built with ctx as calls of the given kind.
+func withCallKind(ctx context.Context, kind CallKind) context.Context {
+	call := callFrom(ctx)
+	call.Kind = kind
+	return context.WithValue(ctx, callKey{}, call)
+}
+
+// withOperation names the operation of the calls made with ctx.
+func withOperation(ctx context.Context, operation, sobject string) context.Context {
+	call := callFrom(ctx)
+	call.Operation = operation
+	call.SObject = sobject
+	return context.WithValue(ctx, callKey{}, call)
+}
+
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	call := callFrom(ctx)
+	call.Attempt = attempt
+	return context.WithValue(ctx, callKey{}, call)
+}
+
+// interceptorTransport runs the interceptor chain in front of the transport of the client.
+type interceptorTransport struct {
+	next         http.RoundTripper
+	interceptors []Interceptor
+}
+
+func (t *interceptorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call := callFrom(req.Context())
+	call.Request = req.Clone(req.Context())
+	if call.Attempt == 0 {
+		call.Attempt = 1
+	}
+
+	return t.invoke(0, &call)
+}
+
+func (t *interceptorTransport) invoke(i int, call *Call) (*http.Response, error) {
+	if i == len(t.interceptors) {
+		return t.next.RoundTrip(call.Request)
+	}
+
+	return t.interceptors[i](call, func(call *Call) (*http.Response, error) {
+		return t.invoke(i+1, call)
+	})
+}
+
+// HeaderInterceptor sets the given headers on every call, e.g. Sforce-Call-Options to
+// attribute API usage to a client id.
+func HeaderInterceptor(header http.Header) Interceptor {
+	return func(call *Call, next Invoker) (*http.Response, error) {
+		for key, values := range header {
+			call.Request.Header[http.CanonicalHeaderKey(key)] = values
+		}
+
+		return next(call)
+	}
+}
+
+// LoggingInterceptor logs every call with its status and latency at debug level, and
+// failed calls at error level. Credentials, tokens and redactedFields are redacted, as
+// with WithRedactedFields.
+func LoggingInterceptor(logger Logger, redactedFields ...string) Interceptor {
+	log := newForceLogger(logger, redactedFields)
+
+	return func(call *Call, next Invoker) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next(call)
+		elapsed := time.Since(start)
+
+		if err != nil {
+			log.error("salesforce call failed",
+				"kind", call.Kind.String(),
+				"operation", call.Operation,
+				"method", call.Request.Method,
+				"path", call.Request.URL.Path,
+				"elapsed", elapsed,
+				"err", err)
+			return resp, err
+		}
+
+		log.debug("salesforce call",
+			"kind", call.Kind.String(),
+			"method", call.Request.Method,
+			"path", call.Request.URL.Path,
+			"status", resp.StatusCode,
+			"elapsed", elapsed)
+
+		return resp, err
+	}
+}
+
+// CallMetrics is the outcome of a single call, as passed to the MetricsInterceptor callback.
+type CallMetrics struct {
+	Kind       CallKind
+	Operation  string
+	SObject    string
+	Attempt    int
+	Method     string
+	Path       string
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// MetricsInterceptor passes the outcome of every call to record, for example to feed
+// latency histograms and error counters.
+func MetricsInterceptor(record func(metrics *CallMetrics)) Interceptor {
+	return func(call *Call, next Invoker) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next(call)
+
+		metrics := &CallMetrics{
+			Kind:      call.Kind,
+			Operation: call.Operation,
+			SObject:   call.SObject,
+			Attempt:   call.Attempt,
+			Method:    call.Request.Method,
+			Path:      call.Request.URL.Path,
+			Duration:  time.Since(start),
+			Err:       err,
+		}
+		if resp != nil {
+			metrics.StatusCode = resp.StatusCode
+		}
+		record(metrics)
+
+		return resp, err
+	}
+}
@@ -0,0 +1,161 @@
+package force
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestInterceptorChain(t *testing.T) {
+	fake := newFakeForce(t)
+
+	var mu sync.Mutex
+	var order []string
+	var kinds []CallKind
+	var callOptions []string
+	fake.mux.HandleFunc("/services/data/"+testVersion+"/limits", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		callOptions = append(callOptions, r.Header.Get("Sforce-Call-Options"))
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	})
+
+	outer := func(call *Call, next Invoker) (*http.Response, error) {
+		mu.Lock()
+		order = append(order, "outer")
+		kinds = append(kinds, call.Kind)
+		mu.Unlock()
+		return next(call)
+	}
+	inner := func(call *Call, next Invoker) (*http.Response, error) {
+		mu.Lock()
+		order = append(order, "inner")
+		mu.Unlock()
+		return next(call)
+	}
+
+	forceApi, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithInterceptors(outer, inner, HeaderInterceptor(http.Header{"Sforce-Call-Options": {"client=my-app"}})),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	out := map[string]interface{}{}
+	if err := forceApi.Get("/services/data/"+testVersion+"/limits", nil, &out); err != nil {
+		t.Fatalf("Unable to get limits: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Login, resources, sobjects and limits.
+	expectedKinds := []CallKind{OAuthCall, RESTCall, RESTCall, RESTCall}
+	if len(kinds) != len(expectedKinds) {
+		t.Fatalf("Expected %v calls through the chain, got %v", len(expectedKinds), kinds)
+	}
+	for i, kind := range expectedKinds {
+		if kinds[i] != kind {
+			t.Fatalf("Expected call %v to be %v, got %v", i, kind, kinds[i])
+		}
+	}
+	if order[0] != "outer" || order[1] != "inner" {
+		t.Fatalf("Expected the first interceptor to run first, got %v", order)
+	}
+	if len(callOptions) != 1 || callOptions[0] != "client=my-app" {
+		t.Fatalf("Expected the Sforce-Call-Options header to be sent, got %v", callOptions)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc("/services/data/"+testVersion+"/limits", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the cached call not to reach the server")
+	})
+
+	cache := func(call *Call, next Invoker) (*http.Response, error) {
+		if !strings.HasSuffix(call.Request.URL.Path, "/limits") {
+			return next(call)
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {jsonType}},
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"DailyApiRequests":{"Max":15000,"Remaining":14998}}`))),
+			Request:    call.Request,
+		}, nil
+	}
+
+	var metrics []*CallMetrics
+	forceApi, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithInterceptors(MetricsInterceptor(func(m *CallMetrics) { metrics = append(metrics, m) }), cache),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	out := map[string]map[string]float64{}
+	if err := forceApi.Get("/services/data/"+testVersion+"/limits", nil, &out); err != nil {
+		t.Fatalf("Unable to get limits: %v", err)
+	}
+	if out["DailyApiRequests"]["Remaining"] != 14998 {
+		t.Fatalf("Expected the cached response, got %v", out)
+	}
+
+	last := metrics[len(metrics)-1]
+	if last.Kind != RESTCall || last.StatusCode != http.StatusOK || !strings.HasSuffix(last.Path, "/limits") {
+		t.Fatalf("Unexpected metrics for the cached call: %+v", last)
+	}
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	fake := newFakeForce(t)
+	logger := &recordingLogger{}
+
+	_, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithInterceptors(LoggingInterceptor(logger)),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	logged := logger.String()
+	if !strings.Contains(logged, "kind oauth") || !strings.Contains(logged, oauthURL) {
+		t.Fatalf("Expected the login to be logged, got: %v", logged)
+	}
+	if strings.Contains(logged, testPassword) {
+		t.Fatalf("Expected no credentials in the log, got: %v", logged)
+	}
+}
+
+func TestLoggingInterceptorRedactedFields(t *testing.T) {
+	fake := newFakeForce(t)
+	logger := &recordingLogger{}
+
+	_, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithInterceptors(LoggingInterceptor(logger, "Path")),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	logged := logger.String()
+	if strings.Contains(logged, oauthURL) || !strings.Contains(logged, redacted) {
+		t.Fatalf("Expected the redacted fields to be left out, got: %v", logged)
+	}
+}
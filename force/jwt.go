@@ -0,0 +1,139 @@
+package force
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Salesforce only accepts assertions that expire within a few minutes.
+const jwtLifetime = 3 * time.Minute
+
+type jwtClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// WithJWT authenticates with the OAuth 2.0 JWT bearer flow. The assertion is signed
+// with privateKeyPEM, the PKCS#1 or PKCS#8 encoded RSA key whose certificate is
+// uploaded to the connected app identified by clientId.
+func WithJWT(clientId, userName string, privateKeyPEM []byte) Option {
+	return func(o *options) {
+		o.flow = jwtFlow
+		o.clientId = clientId
+		o.userName = userName
+		o.privateKeyPEM = privateKeyPEM
+	}
+}
+
+// CreateWithJWT creates a ForceApi authenticated with the OAuth 2.0 JWT bearer flow. A new
+// assertion is signed whenever the session expires.
+func CreateWithJWT(version, clientId, userName string, privateKeyPEM []byte, environment string) (*ForceApi, error) {
+	return CreateWithJWTContext(context.Background(), version, clientId, userName, privateKeyPEM, environment)
+}
+
+// CreateWithJWTContext is like CreateWithJWT but uses ctx for the token exchange and
+// initial resource requests.
+func CreateWithJWTContext(ctx context.Context, version, clientId, userName string, privateKeyPEM []byte,
+	environment string) (*ForceApi, error) {
+	return NewContext(ctx,
+		WithAPIVersion(version),
+		WithEnvironment(environment),
+		WithJWT(clientId, userName, privateKeyPEM),
+	)
+}
+
+func (oauth *forceOauth) AuthenticateWithJWT() error {
+	return oauth.AuthenticateWithJWTContext(context.Background())
+}
+
+func (oauth *forceOauth) AuthenticateWithJWTContext(ctx context.Context) error {
+	assertion, err := oauth.jwtAssertion(time.Now())
+	if err != nil {
+		return err
+	}
+
+	payload := url.Values{
+		"grant_type": {grantTypeJWTBearer},
+		"assertion":  {assertion},
+	}
+
+	return oauth.AuthenticateWithPayloadContext(ctx, payload)
+}
+
+// jwtAudience is the login URL the assertion is intended for, which differs between
+// production and sandbox orgs.
+func (oauth *forceOauth) jwtAudience() string {
+	if oauth.environment == sandboxEnvironment {
+		return sandboxLoginURI
+	}
+
+	return productionLoginURI
+}
+
+// jwtAssertion returns an RS256 signed assertion for the configured user.
+func (oauth *forceOauth) jwtAssertion(now time.Time) (string, error) {
+	key, err := parseRSAPrivateKey(oauth.privateKeyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(&jwtClaims{
+		Issuer:    oauth.clientId,
+		Subject:   oauth.userName,
+		Audience:  oauth.jwtAudience(),
+		ExpiresAt: now.Add(jwtLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	hashed := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func parseRSAPrivateKey(privateKeyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,131 @@
+package force
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestPrivateKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	return key, keyPEM
+}
+
+// verifyJWT checks the signature of an RS256 assertion and returns its claims.
+func verifyJWT(assertion string, key *rsa.PublicKey) (*jwtClaims, error) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed assertion: %v", assertion)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err != nil {
+		return nil, err
+	}
+
+	claimBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	claims := &jwtClaims{}
+	if err := json.Unmarshal(claimBytes, claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func TestJWTAssertion(t *testing.T) {
+	key, keyPEM := newTestPrivateKey(t)
+	oauth := &forceOauth{
+		clientId:      testClientId,
+		userName:      testUserName,
+		environment:   sandboxEnvironment,
+		privateKeyPEM: keyPEM,
+	}
+
+	now := time.Now()
+	assertion, err := oauth.jwtAssertion(now)
+	if err != nil {
+		t.Fatalf("Unable to sign assertion: %v", err)
+	}
+
+	claims, err := verifyJWT(assertion, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("Invalid assertion: %v", err)
+	}
+	if claims.Issuer != testClientId || claims.Subject != testUserName || claims.Audience != sandboxLoginURI {
+		t.Fatalf("Unexpected claims: %+v", claims)
+	}
+	if claims.ExpiresAt != now.Add(jwtLifetime).Unix() {
+		t.Fatalf("Unexpected expiry: %v", claims.ExpiresAt)
+	}
+
+	if _, err := (&forceOauth{privateKeyPEM: []byte("not a key")}).jwtAssertion(now); err == nil {
+		t.Fatal("Expected an error for an invalid private key")
+	}
+}
+
+func TestCreateWithJWT(t *testing.T) {
+	key, keyPEM := newTestPrivateKey(t)
+
+	fake := newFakeForce(t)
+	var assertions int32
+	fake.token = func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != grantTypeJWTBearer {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"unsupported_grant_type","error_description":"grant type not supported"}`)
+			return
+		}
+		if _, err := verifyJWT(r.FormValue("assertion"), &key.PublicKey); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"invalid assertion"}`)
+			return
+		}
+
+		n := atomic.AddInt32(&assertions, 1)
+		fmt.Fprintf(w, `{"access_token":"jwt-token-%d","instance_url":"%s"}`, n, fake.URL)
+	}
+	var calls int32
+	handleSession(fake, "/data", "jwt-token-1", &calls)
+
+	forceApi, err := New(
+		WithLoginURL(fake.URL),
+		WithJWT(testClientId, testUserName, keyPEM),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+	if forceApi.GetAccessToken() != "jwt-token-1" {
+		t.Fatalf("Unexpected access token: %v", forceApi.GetAccessToken())
+	}
+
+	// The first session is rejected, a fresh assertion must be minted rather than using the password flow.
+	if err := forceApi.Get("/data", nil, &map[string]interface{}{}); err != nil {
+		t.Fatalf("Expected the session to be renewed: %v", err)
+	}
+	if forceApi.GetAccessToken() != "jwt-token-2" {
+		t.Fatalf("Unexpected access token: %v", forceApi.GetAccessToken())
+	}
+}
@@ -1,17 +1,213 @@
 package force
 
-type Limits map[string]Limit
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+)
 
+const recordCountUri string = "/recordCount"
+
+// Limits holds the org's limits as returned by the limits resource. The documented limits
+// have a field of their own; All holds every limit returned, including those added to the
+// API after this package was written.
+type Limits struct {
+	ConcurrentAsyncGetReportInstances           Limit
+	ConcurrentSyncReportRuns                    Limit
+	DailyAnalyticsDataflowJobExecutions         Limit
+	DailyApiRequests                            Limit
+	DailyAsyncApexExecutions                    Limit
+	DailyAsyncApexTests                         Limit
+	DailyBulkApiBatches                         Limit
+	DailyBulkV2QueryFileStorageMB               Limit
+	DailyBulkV2QueryJobs                        Limit
+	DailyDurableGenericStreamingApiEvents       Limit
+	DailyDurableStreamingApiEvents              Limit
+	DailyGenericStreamingApiEvents              Limit
+	DailyStandardVolumePlatformEvents           Limit
+	DailyStreamingApiEvents                     Limit
+	DailyWorkflowEmails                         Limit
+	DataStorageMB                               Limit
+	DurableStreamingApiConcurrentClients        Limit
+	FileStorageMB                               Limit
+	HourlyAsyncReportRuns                       Limit
+	HourlyDashboardRefreshes                    Limit
+	HourlyDashboardResults                      Limit
+	HourlyDashboardStatuses                     Limit
+	HourlyLongTermIdMapping                     Limit
+	HourlyODataCallout                          Limit
+	HourlyPublishedPlatformEvents               Limit
+	HourlyPublishedStandardVolumePlatformEvents Limit
+	HourlyShortTermIdMapping                    Limit
+	HourlySyncReportRuns                        Limit
+	HourlyTimeBasedWorkflow                     Limit
+	MassEmail                                   Limit
+	MonthlyPlatformEventsUsageEntitlement       Limit
+	Package2VersionCreates                      Limit
+	Package2VersionCreatesWithoutValidation     Limit
+	PermissionSets                              Limit
+	PrivateConnectOutboundCalloutHourlyLimitMB  Limit
+	SingleEmail                                 Limit
+	StreamingApiConcurrentClients               Limit
+
+	All map[string]Limit
+}
+
+// Limit is the allocation and remaining amount of one limit.
 type Limit struct {
 	Remaining float64
 	Max       float64
+
+	// SubLimits breaks the limit down further, keyed by name. For API request and event
+	// limits these are the shares of the connected apps that have their own allocation,
+	// e.g. "Salesforce Mobile Dashboards"; for PermissionSets the custom permission sets.
+	SubLimits map[string]Limit
+}
+
+// Used returns the amount of the limit that has been used.
+func (limit Limit) Used() float64 {
+	return limit.Max - limit.Remaining
+}
+
+// PercentUsed returns the share of the limit that has been used, from 0 to 100. It is 0
+// for limits without an allocation.
+func (limit Limit) PercentUsed() float64 {
+	if limit.Max <= 0 {
+		return 0
+	}
+
+	return limit.Used() * 100 / limit.Max
+}
+
+// UnmarshalJSON reads Max and Remaining, and any nested limit into SubLimits.
+func (limit *Limit) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	*limit = Limit{}
+	for name, value := range fields {
+		var err error
+		switch name {
+		case "Max":
+			err = json.Unmarshal(value, &limit.Max)
+		case "Remaining":
+			err = json.Unmarshal(value, &limit.Remaining)
+		default:
+			subLimit := Limit{}
+			if err = json.Unmarshal(value, &subLimit); err == nil {
+				if limit.SubLimits == nil {
+					limit.SubLimits = make(map[string]Limit)
+				}
+				limit.SubLimits[name] = subLimit
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalJSON fills All and the field of every documented limit.
+func (limits *Limits) UnmarshalJSON(data []byte) error {
+	all := map[string]Limit{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	*limits = Limits{All: all}
+
+	v := reflect.ValueOf(limits).Elem()
+	limitType := reflect.TypeOf(Limit{})
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Type != limitType {
+			continue
+		}
+		if limit, ok := all[field.Name]; ok {
+			v.Field(i).Set(reflect.ValueOf(limit))
+		}
+	}
+
+	return nil
+}
+
+// Get returns the limit with the given name, as named by the limits resource.
+func (limits *Limits) Get(name string) (Limit, bool) {
+	limit, ok := limits.All[name]
+	return limit, ok
+}
+
+// Over returns the limits of which at least percent have been used.
+func (limits *Limits) Over(percent float64) map[string]Limit {
+	over := make(map[string]Limit)
+	for name, limit := range limits.All {
+		if limit.Max > 0 && limit.PercentUsed() >= percent {
+			over[name] = limit
+		}
+	}
+
+	return over
+}
+
+// RecordCount is the approximate number of records of an sObject.
+type RecordCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type recordCountResponse struct {
+	SObjects []RecordCount `json:"sObjects"`
 }
 
 func (forceApi *ForceApi) GetLimits() (limits *Limits, err error) {
+	return forceApi.GetLimitsContext(context.Background())
+}
+
+// GetLimitsContext is like GetLimits but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) GetLimitsContext(ctx context.Context) (limits *Limits, err error) {
+	ctx = withOperation(ctx, "limits", "")
+
 	uri := forceApi.apiResources[limitsKey]
 
 	limits = &Limits{}
-	err = forceApi.Get(uri, nil, limits)
+	err = forceApi.GetContext(ctx, uri, nil, limits)
 
 	return
 }
+
+// RecordCounts returns the approximate number of records of each of the given sObjects,
+// keyed by sObject name, or of every sObject when none is given. The counts are refreshed
+// by Salesforce periodically, not on every change.
+func (forceApi *ForceApi) RecordCounts(sobjects ...string) (map[string]int64, error) {
+	return forceApi.RecordCountsContext(context.Background(), sobjects...)
+}
+
+// RecordCountsContext is like RecordCounts but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) RecordCountsContext(ctx context.Context, sobjects ...string) (map[string]int64, error) {
+	ctx = withOperation(ctx, "recordCount", "")
+
+	uri := forceApi.apiResources[limitsKey] + recordCountUri
+
+	var params url.Values
+	if len(sobjects) != 0 {
+		params = url.Values{"sObjects": {strings.Join(sobjects, ",")}}
+	}
+
+	resp := &recordCountResponse{}
+	if err := forceApi.GetContext(ctx, uri, params, resp); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(resp.SObjects))
+	for _, count := range resp.SObjects {
+		counts[count.Name] = count.Count
+	}
+
+	return counts, nil
+}
@@ -1,6 +1,7 @@
 package force
 
 import (
+	"net/http"
 	"testing"
 )
 
@@ -15,3 +16,60 @@ func TestLimits(t *testing.T) {
 
 	t.Log(limits)
 }
+
+func TestGetLimitsTyped(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc("/services/data/"+testVersion+"/limits", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"DailyApiRequests": {"Max": 15000, "Remaining": 1500,
+				"Ant Migration Tool": {"Max": 0, "Remaining": 0},
+				"Salesforce Mobile Dashboards": {"Max": 100, "Remaining": 75}},
+			"DataStorageMB": {"Max": 5, "Remaining": 4},
+			"SomeFutureLimit": {"Max": 10, "Remaining": 0}
+		}`))
+	})
+	fake.mux.HandleFunc("/services/data/"+testVersion+"/limits/recordCount", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sObjects") != "Account,Contact" {
+			t.Errorf("Unexpected sObjects parameter: %v", r.URL.Query().Get("sObjects"))
+		}
+		w.Write([]byte(`{"sObjects": [{"count": 3, "name": "Account"}, {"count": 10, "name": "Contact"}]}`))
+	})
+
+	forceApi, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	limits, err := forceApi.GetLimits()
+	if err != nil {
+		t.Fatalf("Unable to get limits: %v", err)
+	}
+
+	apiRequests := limits.DailyApiRequests
+	if apiRequests.Max != 15000 || apiRequests.Used() != 13500 || apiRequests.PercentUsed() != 90 {
+		t.Fatalf("Unexpected DailyApiRequests: %+v", apiRequests)
+	}
+	if dashboards := apiRequests.SubLimits["Salesforce Mobile Dashboards"]; dashboards.PercentUsed() != 25 {
+		t.Fatalf("Unexpected app usage: %+v", apiRequests.SubLimits)
+	}
+	if future, ok := limits.Get("SomeFutureLimit"); !ok || future.Max != 10 {
+		t.Fatalf("Expected undocumented limits to be kept, got %+v", limits.All)
+	}
+
+	over := limits.Over(90)
+	if len(over) != 2 {
+		t.Fatalf("Expected DailyApiRequests and SomeFutureLimit to be over 90%%, got %v", over)
+	}
+
+	counts, err := forceApi.RecordCounts("Account", "Contact")
+	if err != nil {
+		t.Fatalf("Unable to get record counts: %v", err)
+	}
+	if counts["Account"] != 3 || counts["Contact"] != 10 {
+		t.Fatalf("Unexpected record counts: %v", counts)
+	}
+}
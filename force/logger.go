@@ -0,0 +1,182 @@
+package force
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const redacted string = "[REDACTED]"
+
+// Logger receives the log records of a ForceApi. keysAndValues alternate between a key
+// and its value. The method set matches *slog.Logger, so one can be passed as is; adapters
+// for other logging packages are a few lines each.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// Keys whose values are never logged or traced. Matching ignores case.
+var defaultSensitiveKeys = map[string]bool{
+	"password":       true,
+	"client_secret":  true,
+	"security_token": true,
+	"access_token":   true,
+	"refresh_token":  true,
+	"token":          true,
+	"assertion":      true,
+	"code":           true,
+	"code_verifier":  true,
+	"signature":      true,
+	"authorization":  true,
+	"cookie":         true,
+	"set-cookie":     true,
+}
+
+// WithLogger sends the log records of the ForceApi to logger. Nothing is logged by default.
+// Credentials and tokens are redacted before they reach the logger.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithRedactedFields adds keys whose values are redacted from log records and traces, on
+// top of the credentials and tokens that are always redacted. It applies to log keys,
+// form and header names, and the keys of logged maps.
+func WithRedactedFields(keys ...string) Option {
+	return func(o *options) {
+		o.redactedFields = append(o.redactedFields, keys...)
+	}
+}
+
+// forceLogger redacts log records before passing them to a Logger. A nil forceLogger
+// discards everything and redacts only the default keys.
+type forceLogger struct {
+	logger    Logger
+	sensitive map[string]bool
+}
+
+func newForceLogger(logger Logger, redactedFields []string) *forceLogger {
+	sensitive := make(map[string]bool)
+	for key := range defaultSensitiveKeys {
+		sensitive[key] = true
+	}
+	for _, key := range redactedFields {
+		sensitive[strings.ToLower(key)] = true
+	}
+
+	return &forceLogger{logger: logger, sensitive: sensitive}
+}
+
+func (l *forceLogger) debug(msg string, keysAndValues ...interface{}) {
+	if l != nil && l.logger != nil {
+		l.logger.Debug(msg, l.redactAll(keysAndValues)...)
+	}
+}
+
+func (l *forceLogger) info(msg string, keysAndValues ...interface{}) {
+	if l != nil && l.logger != nil {
+		l.logger.Info(msg, l.redactAll(keysAndValues)...)
+	}
+}
+
+func (l *forceLogger) warn(msg string, keysAndValues ...interface{}) {
+	if l != nil && l.logger != nil {
+		l.logger.Warn(msg, l.redactAll(keysAndValues)...)
+	}
+}
+
+func (l *forceLogger) error(msg string, keysAndValues ...interface{}) {
+	if l != nil && l.logger != nil {
+		l.logger.Error(msg, l.redactAll(keysAndValues)...)
+	}
+}
+
+func (l *forceLogger) isSensitive(key string) bool {
+	if l == nil {
+		return defaultSensitiveKeys[strings.ToLower(key)]
+	}
+
+	return l.sensitive[strings.ToLower(key)]
+}
+
+func (l *forceLogger) redactAll(keysAndValues []interface{}) []interface{} {
+	redactedValues := make([]interface{}, len(keysAndValues))
+	copy(redactedValues, keysAndValues)
+
+	for i := 0; i+1 < len(redactedValues); i += 2 {
+		key, _ := redactedValues[i].(string)
+		redactedValues[i+1] = l.redact(key, redactedValues[i+1])
+	}
+
+	return redactedValues
+}
+
+// redact returns value, or a copy of it with the sensitive entries replaced.
+func (l *forceLogger) redact(key string, value interface{}) interface{} {
+	if l.isSensitive(key) {
+		return redacted
+	}
+
+	switch v := value.(type) {
+	case url.Values:
+		return url.Values(l.redactValues(v))
+	case http.Header:
+		return http.Header(l.redactValues(v))
+	case map[string]string:
+		redactedMap := make(map[string]string, len(v))
+		for k, val := range v {
+			if l.isSensitive(k) {
+				val = redacted
+			}
+			redactedMap[k] = val
+		}
+		return redactedMap
+	case map[string]interface{}:
+		redactedMap := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			redactedMap[k] = l.redact(k, val)
+		}
+		return redactedMap
+	}
+
+	return value
+}
+
+func (l *forceLogger) redactValues(values map[string][]string) map[string][]string {
+	redactedValues := make(map[string][]string, len(values))
+	for k, vals := range values {
+		if l.isSensitive(k) {
+			vals = []string{redacted}
+		}
+		redactedValues[k] = vals
+	}
+
+	return redactedValues
+}
+
+// redactRequest returns a copy of req that is safe to log.
+func (l *forceLogger) redactRequest(req *http.Request) *http.Request {
+	redactedReq := req.Clone(req.Context())
+	redactedReq.Header = http.Header(l.redactValues(req.Header))
+
+	redactedURL := *req.URL
+	redactedURL.RawQuery = url.Values(l.redactValues(req.URL.Query())).Encode()
+	redactedReq.URL = &redactedURL
+
+	return redactedReq
+}
+
+// redactResponse returns a copy of resp that is safe to log.
+func (l *forceLogger) redactResponse(resp *http.Response) *http.Response {
+	redactedResp := *resp
+	redactedResp.Header = http.Header(l.redactValues(resp.Header))
+	if resp.Request != nil {
+		redactedResp.Request = l.redactRequest(resp.Request)
+	}
+
+	return &redactedResp
+}
@@ -0,0 +1,129 @@
+package force
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger keeps every log record formatted as a single line.
+type recordingLogger struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (l *recordingLogger) record(level, msg string, keysAndValues []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records = append(l.records, fmt.Sprintf("%s %s %v", level, msg, keysAndValues))
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.record("DEBUG", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.record("INFO", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.record("WARN", msg, keysAndValues)
+}
+
+func (l *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.record("ERROR", msg, keysAndValues)
+}
+
+func (l *recordingLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return strings.Join(l.records, "\n")
+}
+
+func TestLoggerReceivesRecords(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.token = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant","error_description":"authentication failure"}`))
+	}
+	logger := &recordingLogger{}
+
+	_, err := New(
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, "client-secret-value", testUserName, "password-value", "security-token-value"),
+		WithLogger(logger),
+	)
+	if err == nil {
+		t.Fatal("Expected the login to fail")
+	}
+
+	logged := logger.String()
+	if !strings.Contains(logged, "error oauth authenticate on create") {
+		t.Fatalf("Expected the failed login to be logged, got: %v", logged)
+	}
+	for _, secret := range []string{"client-secret-value", "password-value", "security-token-value"} {
+		if strings.Contains(logged, secret) {
+			t.Fatalf("Expected %v to be redacted, got: %v", secret, logged)
+		}
+	}
+}
+
+func TestLoggerRedaction(t *testing.T) {
+	l := newForceLogger(&recordingLogger{}, []string{"SSN__c"})
+
+	redactedValues := l.redactAll([]interface{}{
+		"access_token", "secret-token",
+		"payload", url.Values{"password": {"secret-password"}, "grant_type": {"password"}},
+		"header", http.Header{"Authorization": {"Bearer secret-token"}, "Accept": {jsonType}},
+		"record", map[string]interface{}{"Name": "Jane", "ssn__c": "123-45-6789"},
+	})
+
+	logged := fmt.Sprint(redactedValues)
+	for _, secret := range []string{"secret-token", "secret-password", "123-45-6789"} {
+		if strings.Contains(logged, secret) {
+			t.Fatalf("Expected %v to be redacted, got: %v", secret, logged)
+		}
+	}
+	for _, kept := range []string{"grant_type", "Jane", jsonType} {
+		if !strings.Contains(logged, kept) {
+			t.Fatalf("Expected %v to be kept, got: %v", kept, logged)
+		}
+	}
+}
+
+func TestValidateErrorHidesSession(t *testing.T) {
+	logger := &recordingLogger{}
+	_, err := New(WithAccessToken(testClientId, "secret-access-token", ""), WithLogger(logger))
+	if err == nil {
+		t.Fatal("Expected an error without an instance url")
+	}
+	if strings.Contains(err.Error(), "secret-access-token") || strings.Contains(logger.String(), "secret-access-token") {
+		t.Fatalf("Expected the access token to be left out, got: %v", err)
+	}
+}
+
+func TestTraceRedactsAuthorization(t *testing.T) {
+	fake := newFakeForce(t)
+	forceApi := newTestForceApi(fake.URL)
+
+	var traced strings.Builder
+	forceApi.TraceOn("test", log.New(&traced, "", 0))
+
+	if err := forceApi.getApiResources(context.Background()); err != nil {
+		t.Fatalf("Unable to get api resources: %v", err)
+	}
+
+	if strings.Contains(traced.String(), "test-access-token") {
+		t.Fatalf("Expected the access token to be redacted from traces, got: %v", traced.String())
+	}
+	if !strings.Contains(traced.String(), redacted) {
+		t.Fatalf("Expected the authorization header to be traced as redacted, got: %v", traced.String())
+	}
+}
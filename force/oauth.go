@@ -1,17 +1,29 @@
 package force
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
-
-	"github.com/sirupsen/logrus"
-	"github.com/ztrue/tracerr"
+	"sync"
 )
 
+const renewOperation string = "renew"
+
+// Token is a session issued by the force.com OAuth token endpoint.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	InstanceUrl  string `json:"instance_url"`
+	Id           string `json:"id"`
+	IssuedAt     string `json:"issued_at"`
+	Signature    string `json:"signature"`
+}
+
 type forceOauth struct {
 	AccessToken string `json:"access_token"`
 	InstanceUrl string `json:"instance_url"`
@@ -27,16 +39,214 @@ type forceOauth struct {
 	password      string
 	securityToken string
 	environment   string
+	privateKeyPEM []byte
+	httpClient    *http.Client
+	userAgent     string
+	flow          authFlow
+	store         TokenStore
+	storeKey      string
+	log           *forceLogger
+
+	// mu guards the session fields above, renewMu makes sure only one
+	// caller renews an expired session at a time.
+	mu      sync.RWMutex
+	renewMu sync.Mutex
+}
+
+func (oauth *forceOauth) client() *http.Client {
+	if oauth.httpClient != nil {
+		return oauth.httpClient
+	}
+
+	return http.DefaultClient
 }
 
+func (oauth *forceOauth) agent() string {
+	if len(oauth.userAgent) != 0 {
+		return oauth.userAgent
+	}
+
+	return userAgent
+}
+
+// Validate checks that there is a session to send requests with. The error names the
+// missing field only, never the credentials.
 func (oauth *forceOauth) Validate() error {
-	if oauth == nil || len(oauth.InstanceUrl) == 0 || len(oauth.AccessToken) == 0 {
-		return fmt.Errorf("Invalid Force Oauth Object: %#v", oauth)
+	if oauth == nil {
+		return errors.New("invalid force oauth object: no session")
+	}
+
+	oauth.mu.RLock()
+	defer oauth.mu.RUnlock()
+	if len(oauth.InstanceUrl) == 0 {
+		return errors.New("invalid force oauth object: missing instance url")
+	}
+	if len(oauth.AccessToken) == 0 {
+		return errors.New("invalid force oauth object: missing access token")
 	}
 
 	return nil
 }
 
+// session returns the current access token and instance url.
+func (oauth *forceOauth) session() (accessToken, instanceUrl string) {
+	oauth.mu.RLock()
+	defer oauth.mu.RUnlock()
+
+	return oauth.AccessToken, oauth.InstanceUrl
+}
+
+// setSession replaces the session fields with those of a token response.
+func (oauth *forceOauth) setSession(session *Token) {
+	oauth.mu.Lock()
+	defer oauth.mu.Unlock()
+
+	// Only the web server flow hands out a refresh token, keep it to renew the session.
+	if len(session.RefreshToken) != 0 {
+		oauth.refreshToken = session.RefreshToken
+	}
+
+	oauth.AccessToken = session.AccessToken
+	if len(session.InstanceUrl) != 0 {
+		oauth.InstanceUrl = session.InstanceUrl
+	}
+	if len(session.Id) != 0 {
+		oauth.Id = session.Id
+	}
+	oauth.IssuedAt = session.IssuedAt
+	oauth.Signature = session.Signature
+}
+
+// renew authenticates again with the flow the client was created with. Callers
+// pass the access token that was rejected; if another caller has already replaced
+// it by the time the lock is acquired, the new session is used as is.
+func (oauth *forceOauth) renew(ctx context.Context, staleToken string) error {
+	oauth.renewMu.Lock()
+	defer oauth.renewMu.Unlock()
+
+	if accessToken, _ := oauth.session(); accessToken != staleToken {
+		return nil
+	}
+
+	// Another process sharing the token store may have renewed the session already. A
+	// stored session of another user is never adopted, even if the keys collide.
+	if oauth.store != nil {
+		stored, err := oauth.store.Load(ctx, oauth.storeKey)
+		if err == nil && stored.AccessToken != staleToken && stored.Id == oauth.identityURL() {
+			oauth.setSession(stored)
+			return nil
+		}
+
+		if err := oauth.store.Invalidate(ctx, oauth.storeKey); err != nil {
+			oauth.log.error("error invalidate stored token", "key", oauth.storeKey, "err", err)
+		}
+	}
+
+	if err := oauth.authenticate(withOperation(ctx, renewOperation, "")); err != nil {
+		return &SessionError{Err: err}
+	}
+
+	return nil
+}
+
+// authenticate starts a new session with the flow the client was created with and
+// saves it to the token store.
+func (oauth *forceOauth) authenticate(ctx context.Context) error {
+	var err error
+	switch oauth.flow {
+	case passwordFlow:
+		err = oauth.AuthenticateContext(ctx)
+	case refreshTokenFlow:
+		err = oauth.AuthenticateWithRefreshTokenContext(ctx)
+	case jwtFlow:
+		err = oauth.AuthenticateWithJWTContext(ctx)
+	case clientCredentialsFlow:
+		err = oauth.AuthenticateWithClientCredentialsContext(ctx)
+	default:
+		return errSessionNotRenewable
+	}
+	if err != nil {
+		return err
+	}
+
+	oauth.saveSession(ctx)
+	return nil
+}
+
+// identityURL returns the identity url of the current session.
+func (oauth *forceOauth) identityURL() string {
+	oauth.mu.RLock()
+	defer oauth.mu.RUnlock()
+
+	return oauth.Id
+}
+
+// trustedURL reports whether the absolute uri is on the instance or identity host of the
+// session, the only hosts the access token may be sent to.
+func (oauth *forceOauth) trustedURL(uri string) bool {
+	target, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+
+	oauth.mu.RLock()
+	defer oauth.mu.RUnlock()
+
+	for _, trusted := range []string{oauth.InstanceUrl, oauth.Id} {
+		trustedURL, err := url.Parse(trusted)
+		if err == nil && len(trustedURL.Host) != 0 && trustedURL.Scheme == target.Scheme &&
+			strings.EqualFold(trustedURL.Host, target.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// token returns a copy of the current session.
+func (oauth *forceOauth) token() *Token {
+	oauth.mu.RLock()
+	defer oauth.mu.RUnlock()
+
+	return &Token{
+		AccessToken: oauth.AccessToken,
+		InstanceUrl: oauth.InstanceUrl,
+		Id:          oauth.Id,
+		IssuedAt:    oauth.IssuedAt,
+		Signature:   oauth.Signature,
+	}
+}
+
+// loadSession adopts the session from the token store and reports whether there was one.
+func (oauth *forceOauth) loadSession(ctx context.Context) bool {
+	if oauth.store == nil {
+		return false
+	}
+
+	stored, err := oauth.store.Load(ctx, oauth.storeKey)
+	if err != nil {
+		if err != ErrTokenNotFound {
+			oauth.log.error("error load stored token", "key", oauth.storeKey, "err", err)
+		}
+		return false
+	}
+
+	oauth.setSession(stored)
+	return true
+}
+
+// saveSession writes the current session to the token store. Failing to do so only
+// costs other processes a login, so it is not reported to the caller.
+func (oauth *forceOauth) saveSession(ctx context.Context) {
+	if oauth.store == nil {
+		return
+	}
+
+	if err := oauth.store.Save(ctx, oauth.storeKey, oauth.token()); err != nil {
+		oauth.log.error("error save stored token", "key", oauth.storeKey, "err", err)
+	}
+}
+
 func (oauth *forceOauth) Expired(apiErrors APIErrors) bool {
 	for _, err := range apiErrors {
 		if err.ErrorCode == invalidSessionErrorCode {
@@ -48,6 +258,10 @@ func (oauth *forceOauth) Expired(apiErrors APIErrors) bool {
 }
 
 func (oauth *forceOauth) Authenticate() error {
+	return oauth.AuthenticateContext(context.Background())
+}
+
+func (oauth *forceOauth) AuthenticateContext(ctx context.Context) error {
 	payload := url.Values{
 		"grant_type":    {grantType},
 		"client_id":     {oauth.clientId},
@@ -56,83 +270,90 @@ func (oauth *forceOauth) Authenticate() error {
 		"password":      {fmt.Sprintf("%v%v", oauth.password, oauth.securityToken)},
 	}
 
-	return oauth.AuthenticateWithPayload(payload)
+	return oauth.AuthenticateWithPayloadContext(ctx, payload)
 }
 
 func (oauth *forceOauth) AuthenticateWithRefreshToken() error {
+	return oauth.AuthenticateWithRefreshTokenContext(context.Background())
+}
+
+func (oauth *forceOauth) AuthenticateWithRefreshTokenContext(ctx context.Context) error {
+	oauth.mu.RLock()
+	refreshToken := oauth.refreshToken
+	oauth.mu.RUnlock()
+
 	payload := url.Values{
 		"grant_type":    {grantTypeRefreshToken},
 		"client_id":     {oauth.clientId},
 		"client_secret": {oauth.clientSecret},
-		"refresh_token": {oauth.refreshToken},
+		"refresh_token": {refreshToken},
 	}
 
-	return oauth.AuthenticateWithPayload(payload)
+	return oauth.AuthenticateWithPayloadContext(ctx, payload)
 }
 
 func (oauth *forceOauth) AuthenticateWithPayload(payload url.Values) error {
+	return oauth.AuthenticateWithPayloadContext(context.Background(), payload)
+}
+
+func (oauth *forceOauth) AuthenticateWithPayloadContext(ctx context.Context, payload url.Values) error {
+	respBytes, err := oauth.postForm(ctx, payload.Get("grant_type"), oauthURL, payload)
+	if err != nil {
+		return err
+	}
+
+	session := &Token{}
+	if err := json.Unmarshal(respBytes, session); err != nil {
+		oauth.log.error("error unmarshal authentication response", "grant_type", payload.Get("grant_type"), "err", err)
+		return err
+	}
+	oauth.setSession(session)
+
+	return nil
+}
+
+// postForm posts payload to one of the OAuth endpoints of the login URL and returns the
+// response body, or the error reported by the endpoint. Logins made to renew a session
+// are reported to interceptors as the renew operation.
+func (oauth *forceOauth) postForm(ctx context.Context, operation, path string, payload url.Values) ([]byte, error) {
+	if callFrom(ctx).Operation != renewOperation {
+		ctx = withOperation(ctx, operation, "")
+	}
+
 	// Build Uri
-	uri := oauth.loginURI + oauthURL
+	uri := oauth.loginURI + path
 
 	// Build Body
 	body := strings.NewReader(payload.Encode())
 
 	// Build Request
-	req, err := http.NewRequest("POST", uri, body)
+	req, err := http.NewRequestWithContext(withCallKind(ctx, OAuthCall), "POST", uri, body)
 	if err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"uri":  uri,
-			"body": body,
-			"err":  err,
-		}).Error("error creating http new request")
-		return err
+		oauth.log.error("error creating http new request", "path", path, "err", err)
+		return nil, err
 	}
 
 	// Add Headers
-	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", oauth.agent())
+	req.Header.Set("Content-Type", formURLEncodedType)
 	req.Header.Set("Accept", jsonType)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := oauth.client().Do(req)
 	if err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"req": req,
-			"err": err,
-		}).Error("error client do on authenticate with payload")
-		return err
+		oauth.log.error("error client do on authenticate with payload", "path", path, "err", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	respBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"body": resp.Body,
-			"err":  err,
-		}).Error("error reading authentication response bytes")
-		return err
-	}
-
-	// Attempt to parse response as a force.com api error
-	apiError := &APIError{}
-	if err := json.Unmarshal(respBytes, apiError); err == nil {
-		// Check if api error is valid
-		if apiError.Validate() {
-			return apiError
-		}
+		oauth.log.error("error reading authentication response bytes", "path", path, "err", err)
+		return nil, err
 	}
 
-	if err := json.Unmarshal(respBytes, oauth); err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"oauth":     oauth,
-			"respBytes": string(respBytes),
-			"err":       err,
-		}).Error("error unmarshal authentication response")
-		return err
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, newError(req.Method, path, resp, respBytes)
 	}
 
-	return nil
+	return respBytes, nil
 }
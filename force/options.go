@@ -0,0 +1,251 @@
+package force
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures a ForceApi built by New.
+type Option func(*options)
+
+// authFlow identifies the OAuth flow a ForceApi was created with.
+type authFlow int
+
+const (
+	passwordFlow authFlow = iota
+	refreshTokenFlow
+	accessTokenFlow
+	jwtFlow
+	clientCredentialsFlow
+)
+
+type options struct {
+	flow authFlow
+
+	apiVersion  string
+	loginURI    string
+	environment string
+	userAgent   string
+
+	clientId      string
+	clientSecret  string
+	userName      string
+	password      string
+	securityToken string
+	refreshToken  string
+	accessToken   string
+	instanceUrl   string
+	privateKeyPEM []byte
+
+	httpClient *http.Client
+	transport  http.RoundTripper
+	proxy      func(*http.Request) (*url.URL, error)
+	tlsConfig  *tls.Config
+
+	retryPolicy *RetryPolicy
+
+	tokenStore    TokenStore
+	tokenStoreKey string
+
+	logger         Logger
+	redactedFields []string
+
+	interceptors []Interceptor
+
+	usageThreshold   float64
+	onUsageThreshold func(usage APIUsage)
+	usageThrottle    *APIUsageThrottle
+
+	rateLimits      map[CallKind]RateLimit
+	onRateLimitWait func(kind CallKind, wait time.Duration)
+
+	gzip        bool
+	gzipMinSize int
+
+	onStreamError func(err error)
+	replayStore   ReplayStore
+	streamWorkers *StreamingWorkers
+}
+
+// WithAPIVersion sets the REST API version, e.g. "v36.0".
+func WithAPIVersion(version string) Option {
+	return func(o *options) {
+		o.apiVersion = version
+	}
+}
+
+// WithLoginURL sets the base URL used for OAuth requests, e.g. "https://login.salesforce.com"
+// or the My Domain URL of an org. It defaults to the production or sandbox login URL depending
+// on the environment.
+func WithLoginURL(uri string) Option {
+	return func(o *options) {
+		o.loginURI = uri
+	}
+}
+
+// WithEnvironment sets the environment, "production" or "sandbox".
+func WithEnvironment(environment string) Option {
+	return func(o *options) {
+		o.environment = environment
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithPasswordCredentials authenticates with the OAuth username-password flow.
+func WithPasswordCredentials(clientId, clientSecret, userName, password, securityToken string) Option {
+	return func(o *options) {
+		o.flow = passwordFlow
+		o.clientId = clientId
+		o.clientSecret = clientSecret
+		o.userName = userName
+		o.password = password
+		o.securityToken = securityToken
+	}
+}
+
+// WithRefreshToken authenticates with the OAuth refresh token flow.
+func WithRefreshToken(clientId, clientSecret, refreshToken string) Option {
+	return func(o *options) {
+		o.flow = refreshTokenFlow
+		o.clientId = clientId
+		o.clientSecret = clientSecret
+		o.refreshToken = refreshToken
+	}
+}
+
+// WithAccessToken uses an access token obtained elsewhere instead of logging in.
+func WithAccessToken(clientId, accessToken, instanceUrl string) Option {
+	return func(o *options) {
+		o.flow = accessTokenFlow
+		o.clientId = clientId
+		o.accessToken = accessToken
+		o.instanceUrl = instanceUrl
+	}
+}
+
+// WithHTTPClient sets the http.Client used for REST, OAuth and streaming requests.
+// The client is not modified; when combined with WithTransport, WithProxy or
+// WithTLSConfig a copy of it is used.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithTransport sets the RoundTripper used to send requests.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithProxy routes every request through the given proxy URL.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(o *options) {
+		o.proxy = http.ProxyURL(proxyURL)
+	}
+}
+
+// WithProxyFunc sets the function that picks the proxy for each request,
+// see http.Transport.Proxy.
+func WithProxyFunc(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(o *options) {
+		o.proxy = proxy
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for outgoing connections.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		apiVersion: defaultAPIVersion,
+		userAgent:  userAgent,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if len(o.loginURI) == 0 {
+		if o.environment == sandboxEnvironment {
+			o.loginURI = sandboxLoginURI
+		} else {
+			o.loginURI = productionLoginURI
+		}
+	}
+
+	return o
+}
+
+// buildHTTPClient combines the client, transport, proxy and TLS options into the
+// http.Client shared by the ForceApi and its OAuth and streaming requests.
+func (o *options) buildHTTPClient(limiter *rateLimiter) (*http.Client, error) {
+	client := &http.Client{}
+	if o.httpClient != nil {
+		copied := *o.httpClient
+		client = &copied
+	}
+
+	transport := o.transport
+	if transport == nil {
+		transport = client.Transport
+	}
+
+	if o.proxy != nil || o.tlsConfig != nil {
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+
+		base, ok := transport.(*http.Transport)
+		if !ok {
+			return nil, errors.New("force: proxy and TLS options require an *http.Transport")
+		}
+
+		base = base.Clone()
+		if o.proxy != nil {
+			base.Proxy = o.proxy
+		}
+		if o.tlsConfig != nil {
+			base.TLSClientConfig = o.tlsConfig
+		}
+		transport = base
+	}
+
+	if o.gzip {
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		transport = &gzipTransport{next: transport}
+	}
+
+	if limiter != nil {
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		transport = &rateLimitTransport{next: transport, limiter: limiter}
+	}
+
+	if len(o.interceptors) != 0 {
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		transport = &interceptorTransport{next: transport, interceptors: o.interceptors}
+	}
+
+	client.Transport = transport
+
+	return client, nil
+}
@@ -0,0 +1,110 @@
+package force
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type recordingTransport struct {
+	requests []*http.Request
+	next     http.RoundTripper
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.requests = append(rt.requests, req)
+	return rt.next.RoundTrip(req)
+}
+
+func TestNewWithOptions(t *testing.T) {
+	fake := newFakeForce(t)
+	transport := &recordingTransport{next: http.DefaultTransport}
+
+	forceApi, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithTransport(transport),
+		WithUserAgent("my-agent/1.0"),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	if forceApi.GetAccessToken() != "token-1" {
+		t.Fatalf("Unexpected access token: %v", forceApi.GetAccessToken())
+	}
+	if forceApi.GetInstanceURL() != fake.URL {
+		t.Fatalf("Unexpected instance url: %v", forceApi.GetInstanceURL())
+	}
+	if _, ok := forceApi.apiSObjects["Account"]; !ok {
+		t.Fatalf("Expected sobjects to be loaded, got: %v", forceApi.apiSObjects)
+	}
+
+	// Login, resources and sobjects must all go through the custom transport.
+	if len(transport.requests) != 3 {
+		t.Fatalf("Expected 3 requests through the transport, got %v", len(transport.requests))
+	}
+	for _, req := range transport.requests {
+		if req.Header.Get("User-Agent") != "my-agent/1.0" {
+			t.Fatalf("Unexpected user agent for %v: %v", req.URL, req.Header.Get("User-Agent"))
+		}
+	}
+}
+
+func TestNewWithRefreshToken(t *testing.T) {
+	fake := newFakeForce(t)
+
+	forceApi, err := New(
+		WithLoginURL(fake.URL),
+		WithRefreshToken(testClientId, testClientSecret, "refresh"),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+	if forceApi.GetAccessToken() != "token-1" {
+		t.Fatalf("Unexpected access token: %v", forceApi.GetAccessToken())
+	}
+}
+
+func TestNewDefaultLoginURL(t *testing.T) {
+	if o := newOptions(nil); o.loginURI != productionLoginURI {
+		t.Fatalf("Unexpected production login url: %v", o.loginURI)
+	}
+	if o := newOptions([]Option{WithEnvironment(sandboxEnvironment)}); o.loginURI != sandboxLoginURI {
+		t.Fatalf("Unexpected sandbox login url: %v", o.loginURI)
+	}
+}
+
+func TestBuildHTTPClient(t *testing.T) {
+	proxyURL, _ := url.Parse("http://proxy.example.com:3128")
+	tlsConfig := &tls.Config{ServerName: "example.com"}
+	base := &http.Client{}
+
+	o := newOptions([]Option{WithHTTPClient(base), WithProxy(proxyURL), WithTLSConfig(tlsConfig)})
+	client, err := o.buildHTTPClient(nil)
+	if err != nil {
+		t.Fatalf("Unable to build http client: %v", err)
+	}
+	if client == base || base.Transport != nil {
+		t.Fatal("The caller's http client must not be modified")
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Unexpected transport type: %T", client.Transport)
+	}
+	if transport.TLSClientConfig != tlsConfig {
+		t.Fatal("TLS config was not applied")
+	}
+	got, err := transport.Proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: "login.salesforce.com"}})
+	if err != nil || got.String() != proxyURL.String() {
+		t.Fatalf("Unexpected proxy: %v %v", got, err)
+	}
+
+	o = newOptions([]Option{WithTransport(&recordingTransport{}), WithProxy(proxyURL)})
+	if _, err := o.buildHTTPClient(nil); err == nil {
+		t.Fatal("Expected an error combining a custom RoundTripper with a proxy")
+	}
+}
@@ -1,6 +1,7 @@
 package force
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
@@ -18,13 +19,20 @@ func BuildQuery(fields, table string, constraints []string) string {
 // Use the Query resource to execute a SOQL query that returns all the results in a single response,
 // or if needed, returns part of the results and an identifier used to retrieve the remaining results.
 func (forceApi *ForceApi) Query(query string, out interface{}) (err error) {
+	return forceApi.QueryContext(context.Background(), query, out)
+}
+
+// QueryContext is like Query but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) QueryContext(ctx context.Context, query string, out interface{}) (err error) {
+	ctx = withOperation(ctx, "query", "")
+
 	uri := forceApi.apiResources[queryKey]
 
 	params := url.Values{
 		"q": {query},
 	}
 
-	err = forceApi.Get(uri, params, out)
+	err = forceApi.GetContext(ctx, uri, params, out)
 
 	return
 }
@@ -33,19 +41,33 @@ func (forceApi *ForceApi) Query(query string, out interface{}) (err error) {
 // been deleted because of a merge or delete. Use QueryAll rather than Query, because the Query resource
 // will automatically filter out items that have been deleted.
 func (forceApi *ForceApi) QueryAll(query string, out interface{}) (err error) {
+	return forceApi.QueryAllContext(context.Background(), query, out)
+}
+
+// QueryAllContext is like QueryAll but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) QueryAllContext(ctx context.Context, query string, out interface{}) (err error) {
+	ctx = withOperation(ctx, "queryAll", "")
+
 	uri := forceApi.apiResources[queryAllKey]
 
 	params := url.Values{
 		"q": {query},
 	}
 
-	err = forceApi.Get(uri, params, out)
+	err = forceApi.GetContext(ctx, uri, params, out)
 
 	return
 }
 
 func (forceApi *ForceApi) QueryNext(uri string, out interface{}) (err error) {
-	err = forceApi.Get(uri, nil, out)
+	return forceApi.QueryNextContext(context.Background(), uri, out)
+}
+
+// QueryNextContext is like QueryNext but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) QueryNextContext(ctx context.Context, uri string, out interface{}) (err error) {
+	ctx = withOperation(ctx, "queryMore", "")
+
+	err = forceApi.GetContext(ctx, uri, nil, out)
 
 	return
 }
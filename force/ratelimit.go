@@ -0,0 +1,260 @@
+package force
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is the budget of one kind of call. Zero fields mean no limit.
+type RateLimit struct {
+	// RequestsPerSecond is the sustained rate at which calls are sent.
+	RequestsPerSecond float64
+
+	// Burst is the number of calls that may be sent at once after a quiet period.
+	// It defaults to 1.
+	Burst int
+
+	// MaxConcurrent is the number of calls in flight at the same time. A call is in
+	// flight until its response body is closed, so streaming long polls hold their slot
+	// for the whole poll.
+	MaxConcurrent int
+}
+
+// RateLimitStats reports how the limiter of one kind of call has been used.
+type RateLimitStats struct {
+	InFlight int
+	Requests int64
+
+	// Delayed counts the calls that had to wait for the limiter, TotalWait sums their waits.
+	Delayed   int64
+	TotalWait time.Duration
+}
+
+// WithRateLimit limits the calls of the given kind, e.g. WithRateLimit(BulkCall, ...).
+// Each kind has its own budget, shared by every request of the ForceApi, retries included.
+func WithRateLimit(kind CallKind, limit RateLimit) Option {
+	return func(o *options) {
+		if o.rateLimits == nil {
+			o.rateLimits = make(map[CallKind]RateLimit)
+		}
+		o.rateLimits[kind] = limit
+	}
+}
+
+// WithRateLimitWaitHook calls fn with the time every rate limited call waited for the
+// limiter, including calls that did not wait at all, e.g. to feed a histogram.
+func WithRateLimitWaitHook(fn func(kind CallKind, wait time.Duration)) Option {
+	return func(o *options) {
+		o.onRateLimitWait = fn
+	}
+}
+
+// RateLimitStats returns the usage of the limiter of the given kind of call. It is zero
+// when that kind of call is not limited.
+func (forceApi *ForceApi) RateLimitStats(kind CallKind) RateLimitStats {
+	return forceApi.limiter.stats(kind)
+}
+
+// rateLimiter governs the calls of each kind according to its RateLimit.
+type rateLimiter struct {
+	limits map[CallKind]*kindLimiter
+	onWait func(kind CallKind, wait time.Duration)
+}
+
+type kindLimiter struct {
+	bucket *tokenBucket
+	slots  chan struct{}
+
+	mu    sync.Mutex
+	stats RateLimitStats
+}
+
+func newRateLimiter(limits map[CallKind]RateLimit, onWait func(kind CallKind, wait time.Duration)) *rateLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+
+	limiter := &rateLimiter{limits: make(map[CallKind]*kindLimiter), onWait: onWait}
+	for kind, limit := range limits {
+		kl := &kindLimiter{}
+		if limit.RequestsPerSecond > 0 {
+			kl.bucket = newTokenBucket(limit.RequestsPerSecond, limit.Burst)
+		}
+		if limit.MaxConcurrent > 0 {
+			kl.slots = make(chan struct{}, limit.MaxConcurrent)
+		}
+		limiter.limits[kind] = kl
+	}
+
+	return limiter
+}
+
+func (limiter *rateLimiter) stats(kind CallKind) RateLimitStats {
+	if limiter == nil {
+		return RateLimitStats{}
+	}
+
+	kl, ok := limiter.limits[kind]
+	if !ok {
+		return RateLimitStats{}
+	}
+
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	return kl.stats
+}
+
+// acquire waits until a call of the given kind may be sent. The returned release must be
+// called once the call is done.
+func (limiter *rateLimiter) acquire(ctx context.Context, kind CallKind) (func(), error) {
+	kl, ok := limiter.limits[kind]
+	if !ok {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+
+	if kl.slots != nil {
+		select {
+		case kl.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	release := func() {
+		if kl.slots != nil {
+			<-kl.slots
+		}
+		kl.mu.Lock()
+		kl.stats.InFlight--
+		kl.mu.Unlock()
+	}
+
+	if kl.bucket != nil {
+		if err := kl.bucket.wait(ctx); err != nil {
+			if kl.slots != nil {
+				<-kl.slots
+			}
+			return nil, err
+		}
+	}
+
+	wait := time.Since(start)
+
+	kl.mu.Lock()
+	kl.stats.InFlight++
+	kl.stats.Requests++
+	if wait >= time.Millisecond {
+		kl.stats.Delayed++
+		kl.stats.TotalWait += wait
+	}
+	kl.mu.Unlock()
+
+	if limiter.onWait != nil {
+		limiter.onWait(kind, wait)
+	}
+
+	return release, nil
+}
+
+// tokenBucket paces calls to a sustained rate while allowing short bursts.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token, waiting for it to be refilled if there is none left. A wait that
+// is canceled gives its token back.
+func (bucket *tokenBucket) wait(ctx context.Context) error {
+	bucket.mu.Lock()
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.rate
+	if bucket.tokens > bucket.burst {
+		bucket.tokens = bucket.burst
+	}
+	bucket.last = now
+	bucket.tokens--
+	tokens := bucket.tokens
+	bucket.mu.Unlock()
+
+	if tokens >= 0 {
+		return nil
+	}
+
+	wait := time.Duration(-tokens / bucket.rate * float64(time.Second))
+	if err := sleepContext(ctx, wait); err != nil {
+		bucket.mu.Lock()
+		bucket.tokens++
+		bucket.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// rateLimitTransport holds every request until the limiter of its kind of call lets it through.
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.acquire(req.Context(), callFrom(req.Context()).Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+
+	return resp, nil
+}
+
+// releasingBody gives the slot of a call back once its response has been read.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (body *releasingBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(body.release)
+
+	return err
+}
+
+// isBulkPath reports whether path belongs to the Bulk API, either the original one or
+// Bulk API 2.0.
+func isBulkPath(path string) bool {
+	return strings.Contains(path, "/services/async/") || strings.Contains(path, "/jobs/ingest") ||
+		strings.Contains(path, "/jobs/query")
+}
@@ -0,0 +1,107 @@
+package force
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMaxConcurrent(t *testing.T) {
+	fake := newFakeForce(t)
+
+	var inFlight, maxInFlight int32
+	fake.mux.HandleFunc("/services/data/"+testVersion+"/limits", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{}`))
+	})
+
+	forceApi, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithRateLimit(RESTCall, RateLimit{MaxConcurrent: 2}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := forceApi.Get("/services/data/"+testVersion+"/limits", nil, &map[string]interface{}{}); err != nil {
+				t.Errorf("Unable to get limits: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Fatalf("Expected at most 2 concurrent requests, got %v", maxInFlight)
+	}
+
+	stats := forceApi.RateLimitStats(RESTCall)
+	if stats.InFlight != 0 {
+		t.Fatalf("Expected every slot to be released, got %+v", stats)
+	}
+	// Resources, sobjects and the 8 limits requests.
+	if stats.Requests != 10 || stats.Delayed == 0 {
+		t.Fatalf("Unexpected rate limit stats: %+v", stats)
+	}
+}
+
+func TestRateLimitRequestsPerSecond(t *testing.T) {
+	fake := newFakeForce(t)
+	fake.mux.HandleFunc("/services/async/"+testVersion[1:]+"/job", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+
+	var mu sync.Mutex
+	waits := map[CallKind]int{}
+	forceApi, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithRateLimit(BulkCall, RateLimit{RequestsPerSecond: 20}),
+		WithRateLimitWaitHook(func(kind CallKind, wait time.Duration) {
+			mu.Lock()
+			waits[kind]++
+			mu.Unlock()
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := forceApi.Post("/services/async/"+testVersion[1:]+"/job", nil, map[string]string{}, nil); err != nil {
+			t.Fatalf("Unable to create job: %v", err)
+		}
+	}
+
+	// The first request takes the only token, the 4 others wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Fatalf("Expected the bulk requests to be paced, took %v", elapsed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if waits[BulkCall] != 5 || waits[RESTCall] != 0 {
+		t.Fatalf("Expected only the bulk requests to be limited, got %v", waits)
+	}
+	if stats := forceApi.RateLimitStats(BulkCall); stats.Requests != 5 || stats.Delayed != 4 {
+		t.Fatalf("Unexpected rate limit stats: %+v", stats)
+	}
+}
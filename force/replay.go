@@ -0,0 +1,268 @@
+package force
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Replay ids that subscribe to events without a stored position: ReplayNewEvents delivers
+// the events published after subscribing, ReplayAllEvents every event still retained by
+// Salesforce, up to 72 hours back.
+const (
+	ReplayNewEvents int64 = -1
+	ReplayAllEvents int64 = -2
+)
+
+// ErrReplayIDNotFound is returned by a ReplayStore that holds no replay id for a channel.
+var ErrReplayIDNotFound = errors.New("replay id not found")
+
+// ReplayStore persists the replay id of the last event processed on each channel, so that
+// a subscription resumes where the previous process stopped instead of losing the events
+// published in between. A store holds the positions of one consumer of one org.
+type ReplayStore interface {
+	// Load returns the stored replay id for channel, or ErrReplayIDNotFound.
+	Load(ctx context.Context, channel string) (int64, error)
+	Save(ctx context.Context, channel string, replayID int64) error
+}
+
+// WithReplayStore resumes streaming subscriptions from the replay ids in store, and saves
+// the replay id of every event once its callback has returned.
+func WithReplayStore(store ReplayStore) Option {
+	return func(o *options) {
+		o.replayStore = store
+	}
+}
+
+// replayExtension is the Bayeux extension Salesforce reads replay ids from.
+const replayExtension string = "replay"
+
+// replayGap is the first message of a channel that was not handled, see dropped.
+type replayGap struct {
+	replayID int64
+	// generation is the generation of the messages delivered since the channel was
+	// subscribed again to redeliver the message, or 0 until then.
+	generation int64
+}
+
+// replayExt returns the extension that subscribes to channel from its replay position, or
+// from right before its first dropped message. The messages before that one are handled
+// already or still queued.
+func (s *StreamsForce) replayExt(channel string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replayID, ok := s.replayIDs[channel]
+	if !ok {
+		return nil
+	}
+	if gap, dropped := s.gaps[channel]; dropped {
+		replayID = gap.replayID - 1
+	}
+
+	return map[string]interface{}{replayExtension: map[string]int64{channel: replayID}}
+}
+
+// startReplayID returns the replay id to subscribe to channel from: the stored one, or
+// replayID when the store holds none.
+func (s *StreamsForce) startReplayID(ctx context.Context, channel string, replayID int64) (int64, error) {
+	store := s.APIForce.replayStore
+	if store == nil {
+		return replayID, nil
+	}
+
+	stored, err := store.Load(ctx, channel)
+	if err == ErrReplayIDNotFound {
+		return replayID, nil
+	}
+
+	return stored, err
+}
+
+// processed records msg as processed: a later subscription to its channel, after a
+// handshake or a restart, starts after it. The position of a channel does not move past a
+// dropped message until it has been delivered again and handled, see dropped.
+func (s *StreamsForce) processed(msg *Message) {
+	replayID := msg.ReplayID
+	if replayID <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	_, subscribed := s.replayIDs[msg.Channel]
+	gap, dropped := s.gaps[msg.Channel]
+	if dropped && gap.generation != 0 && msg.generation >= gap.generation && replayID >= gap.replayID {
+		delete(s.gaps, msg.Channel)
+		dropped = false
+	}
+	advance := subscribed && (!dropped || replayID < gap.replayID)
+	if advance {
+		s.replayIDs[msg.Channel] = replayID
+	}
+	s.mu.Unlock()
+
+	if store := s.APIForce.replayStore; advance && store != nil {
+		if err := store.Save(context.Background(), msg.Channel, replayID); err != nil {
+			s.reportError(err)
+		}
+	}
+}
+
+// dropped records that msg was not handled, and reports why. The replay position of its
+// channel no longer moves past msg, and the streaming loop subscribes to the channel again
+// to have msg delivered again, along with the messages handled since, see redeliver.
+func (s *StreamsForce) dropped(msg *Message, err error) {
+	s.mu.Lock()
+	_, subscribed := s.replayIDs[msg.Channel]
+	gap, dropped := s.gaps[msg.Channel]
+	// The messages after the gap are delivered again along with it. Only the gap itself,
+	// dropped again once redelivered, needs another subscription.
+	redelivered := dropped && gap.generation != 0 && msg.generation >= gap.generation
+	if subscribed && msg.ReplayID > 0 &&
+		(!dropped || msg.ReplayID < gap.replayID || redelivered && msg.ReplayID == gap.replayID) {
+		s.gaps[msg.Channel] = &replayGap{replayID: msg.ReplayID}
+	}
+	s.mu.Unlock()
+
+	s.reportError(err)
+}
+
+// redeliver subscribes again to the channels with a dropped message that was not
+// redelivered yet, from right before the message.
+func (s *StreamsForce) redeliver(ctx context.Context) {
+	s.subscribeMu.Lock()
+	defer s.subscribeMu.Unlock()
+
+	s.mu.Lock()
+	var channels []string
+	for channel, gap := range s.gaps {
+		if gap.generation == 0 {
+			channels = append(channels, channel)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, channel := range channels {
+		// Failing to unsubscribe is no reason not to subscribe.
+		if _, err := s.unsubscribe(ctx, channel); err != nil {
+			s.reportError(err)
+		}
+		if _, err := s.subscribe(ctx, channel); err != nil {
+			s.reportError(err)
+			continue
+		}
+		s.resubscribed(channel)
+	}
+}
+
+// resubscribed records that channel was subscribed again, so that the messages delivered
+// from now on belong to a new generation, and a dropped message among them is a
+// redelivery. It is only called from the streaming loop, which dispatches the messages.
+func (s *StreamsForce) resubscribed(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	if gap, dropped := s.gaps[channel]; dropped {
+		gap.generation = s.generation
+	}
+}
+
+// eventReplayID returns the replay id of a delivered event, found in data.event.replayId.
+func eventReplayID(data json.RawMessage) (int64, bool) {
+	var event struct {
+		Event struct {
+			ReplayID *int64 `json:"replayId"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil || event.Event.ReplayID == nil {
+		return 0, false
+	}
+
+	return *event.Event.ReplayID, true
+}
+
+// MemoryReplayStore keeps replay ids in memory. It lets a subscription resume after the
+// client handshakes again or reconnects within one process.
+type MemoryReplayStore struct {
+	mu        sync.RWMutex
+	replayIDs map[string]int64
+}
+
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{replayIDs: make(map[string]int64)}
+}
+
+func (store *MemoryReplayStore) Load(ctx context.Context, channel string) (int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	replayID, ok := store.replayIDs[channel]
+	if !ok {
+		return 0, ErrReplayIDNotFound
+	}
+
+	return replayID, nil
+}
+
+func (store *MemoryReplayStore) Save(ctx context.Context, channel string, replayID int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.replayIDs[channel] = replayID
+	return nil
+}
+
+// FileReplayStore keeps the replay id of each channel in a JSON file in Dir. It lets a
+// subscription resume after the process restarts.
+type FileReplayStore struct {
+	Dir string
+}
+
+type replayFile struct {
+	Channel  string `json:"channel"`
+	ReplayID int64  `json:"replayId"`
+}
+
+func NewFileReplayStore(dir string) (*FileReplayStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileReplayStore{Dir: dir}, nil
+}
+
+// path returns the file for channel. Channels are hashed since they contain slashes.
+func (store *FileReplayStore) path(channel string) string {
+	return hashedPath(store.Dir, channel)
+}
+
+func (store *FileReplayStore) Load(ctx context.Context, channel string) (int64, error) {
+	replayBytes, err := ioutil.ReadFile(store.path(channel))
+	if os.IsNotExist(err) {
+		return 0, ErrReplayIDNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	replay := &replayFile{}
+	if err := json.Unmarshal(replayBytes, replay); err != nil {
+		return 0, err
+	}
+
+	return replay.ReplayID, nil
+}
+
+// Save writes the replay id atomically, so that a crash never leaves a partial file behind.
+func (store *FileReplayStore) Save(ctx context.Context, channel string, replayID int64) error {
+	replayBytes, err := json.Marshal(&replayFile{Channel: channel, ReplayID: replayID})
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(store.path(channel), replayBytes)
+}
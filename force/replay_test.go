@@ -0,0 +1,147 @@
+package force
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func testReplayStore(t *testing.T, store ReplayStore) {
+	ctx := context.Background()
+
+	if _, err := store.Load(ctx, "/data/AccountChangeEvent"); err != ErrReplayIDNotFound {
+		t.Fatalf("Expected ErrReplayIDNotFound, got: %v", err)
+	}
+
+	for _, replayID := range []int64{10, 11} {
+		if err := store.Save(ctx, "/data/AccountChangeEvent", replayID); err != nil {
+			t.Fatalf("Unable to save replay id: %v", err)
+		}
+	}
+	if err := store.Save(ctx, "/event/Order__e", 3); err != nil {
+		t.Fatalf("Unable to save replay id: %v", err)
+	}
+
+	replayID, err := store.Load(ctx, "/data/AccountChangeEvent")
+	if err != nil {
+		t.Fatalf("Unable to load replay id: %v", err)
+	}
+	if replayID != 11 {
+		t.Fatalf("Expected the last saved replay id, got %v", replayID)
+	}
+}
+
+func TestMemoryReplayStore(t *testing.T) {
+	testReplayStore(t, NewMemoryReplayStore())
+}
+
+func TestFileReplayStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileReplayStore(dir)
+	if err != nil {
+		t.Fatalf("Unable to create file replay store: %v", err)
+	}
+	testReplayStore(t, store)
+
+	// A new store on the same directory resumes from the saved replay ids.
+	reopened, _ := NewFileReplayStore(dir)
+	if replayID, err := reopened.Load(context.Background(), "/event/Order__e"); err != nil || replayID != 3 {
+		t.Fatalf("Expected the replay id to survive a restart, got %v, %v", replayID, err)
+	}
+
+	info, err := os.Stat(store.path("/event/Order__e"))
+	if err != nil {
+		t.Fatalf("Replay file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Replay file must only be readable by the owner, got %v", info.Mode().Perm())
+	}
+}
+
+// subscribedReplayID returns the replay id the nth subscription to channel was sent with.
+func subscribedReplayID(t *testing.T, cometd *fakeCometd, n int, channel string) float64 {
+	t.Helper()
+
+	subscribes := cometd.sent(metaSubscribe)
+	if len(subscribes) <= n {
+		t.Fatalf("Expected %v subscriptions, got %v", n+1, len(subscribes))
+	}
+	replay, _ := subscribes[n].Ext[replayExtension].(map[string]interface{})
+	replayID, ok := replay[channel].(float64)
+	if !ok {
+		t.Fatalf("Expected a replay id for %v, got ext %v", channel, subscribes[n].Ext)
+	}
+
+	return replayID
+}
+
+func TestStreamingReplay(t *testing.T) {
+	cometd := newFakeCometd(t)
+	store := NewMemoryReplayStore()
+	store.Save(context.Background(), "/data/AccountChangeEvent", 5)
+
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.replayStore = store
+	forceApi.onStreamError = func(error) {}
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer forceApi.DisconnectStreamingAPI()
+
+	if ext := cometd.sent(metaHandshake)[0].Ext; ext[replayExtension] != true {
+		t.Fatalf("Expected the handshake to ask for replay support, got ext %v", ext)
+	}
+
+	accounts, orders := make(receiveMessages, 10), make(receiveMessages, 10)
+	if _, err := forceApi.Subscribe("CDC", "Account", accounts.callback); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+	if _, err := forceApi.SubscribeWithReplay("Event", "Order__e", ReplayAllEvents, orders.callback); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+	if replayID := subscribedReplayID(t, cometd, 0, "/data/AccountChangeEvent"); replayID != 5 {
+		t.Fatalf("Expected the subscription to resume from the stored replay id, got %v", replayID)
+	}
+	if replayID := subscribedReplayID(t, cometd, 1, "/event/Order__e"); replayID != float64(ReplayAllEvents) {
+		t.Fatalf("Expected the subscription to replay all events, got %v", replayID)
+	}
+
+	for replayID := 6; replayID <= 7; replayID++ {
+		data := fmt.Sprintf(`{"event":{"replayId":%d},"payload":{}}`, replayID)
+		cometd.publish("/data/AccountChangeEvent", data)
+		accounts.expect(t, data)
+	}
+
+	// The replay id is saved right after the callback returns.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		replayID, _ := store.Load(context.Background(), "/data/AccountChangeEvent")
+		if replayID == 7 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the replay id of the processed event to be saved, got %v", replayID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cometd.forget()
+	cometd.waitForHandshakes(t, 2)
+	deadline = time.Now().Add(5 * time.Second)
+	for len(cometd.sent(metaSubscribe)) < 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the subscriptions to be restored")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	n := 2
+	if cometd.sent(metaSubscribe)[n].Subscription != "/data/AccountChangeEvent" {
+		n = 3
+	}
+	if replayID := subscribedReplayID(t, cometd, n, "/data/AccountChangeEvent"); replayID != 7 {
+		t.Fatalf("Expected the restored subscription to resume after the last processed event, got %v", replayID)
+	}
+}
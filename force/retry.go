@@ -0,0 +1,227 @@
+package force
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Salesforce error codes that mean the request was rejected without being applied,
+// so it is safe to send it again.
+const (
+	requestLimitExceededErrorCode string = "REQUEST_LIMIT_EXCEEDED"
+	unableToLockRowErrorCode      string = "UNABLE_TO_LOCK_ROW"
+	serverUnavailableErrorCode    string = "SERVER_UNAVAILABLE"
+)
+
+// RetryPolicy controls how requests that fail with a transient error are retried.
+// A ForceApi without a retry policy sends every request exactly once.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+
+	// MinBackoff is the wait before the first retry. It doubles on every further
+	// retry up to MaxBackoff. A random jitter of up to half the wait is subtracted
+	// so that many clients do not retry in lockstep. A Retry-After header replaces
+	// the backoff, but is capped at MaxBackoff as well.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// ShouldRetry decides whether a failed attempt is retried. It defaults to
+	// DefaultShouldRetry; custom implementations can call it for the cases they
+	// do not classify themselves.
+	ShouldRetry func(attempt *RetryAttempt) bool
+}
+
+// RetryAttempt describes the outcome of a single attempt of a request.
+type RetryAttempt struct {
+	Method  string
+	URL     string
+	Attempt int
+
+	// Idempotent reports whether the request can be replayed without side effects
+	// even if the first attempt reached Salesforce.
+	Idempotent bool
+
+	// StatusCode and Header are zero when no response was received.
+	StatusCode int
+	Header     http.Header
+
+	// APIErrors holds the errors returned by Salesforce for a failed response.
+	APIErrors APIErrors
+
+	// Err is the transport error when no response was received.
+	Err error
+}
+
+// DefaultRetryPolicy returns a policy of up to 4 attempts with backoff from 500ms to 10s.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		MinBackoff:  500 * time.Millisecond,
+		MaxBackoff:  10 * time.Second,
+		ShouldRetry: DefaultShouldRetry,
+	}
+}
+
+// WithRetryPolicy retries transient failures of REST requests according to policy.
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(o *options) {
+		o.retryPolicy = policy
+	}
+}
+
+// DefaultShouldRetry retries requests that Salesforce rejected without applying them:
+// REQUEST_LIMIT_EXCEEDED, UNABLE_TO_LOCK_ROW, SERVER_UNAVAILABLE, 429 and 503. Network
+// errors and other 5xx responses are only retried for idempotent requests, since a
+// POST may already have created a record.
+func DefaultShouldRetry(attempt *RetryAttempt) bool {
+	for _, apiErr := range attempt.APIErrors {
+		switch apiErr.ErrorCode {
+		case requestLimitExceededErrorCode, unableToLockRowErrorCode, serverUnavailableErrorCode:
+			return true
+		}
+	}
+
+	switch {
+	case attempt.StatusCode == http.StatusTooManyRequests, attempt.StatusCode == http.StatusServiceUnavailable:
+		return true
+	case !attempt.Idempotent:
+		return false
+	case attempt.Err != nil:
+		return true
+	case attempt.StatusCode >= http.StatusInternalServerError:
+		return true
+	}
+
+	return false
+}
+
+// isIdempotent reports whether a request with the given method can safely be sent twice.
+// Salesforce uses PATCH for record updates and upserts by external id, both of which
+// leave the record in the same state when replayed.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+func newRetryAttempt(ctx context.Context, method, uri string, attempt int, resp *http.Response, respBytes []byte, err error) *RetryAttempt {
+	retryAttempt := &RetryAttempt{
+		Method:     method,
+		URL:        uri,
+		Attempt:    attempt,
+		Idempotent: isIdempotent(method),
+		Err:        err,
+	}
+
+	// A canceled or expired context is never worth retrying.
+	if err != nil && ctx.Err() != nil {
+		retryAttempt.Err = ctx.Err()
+	}
+
+	if resp != nil {
+		retryAttempt.StatusCode = resp.StatusCode
+		retryAttempt.Header = resp.Header
+		if resp.StatusCode >= http.StatusBadRequest {
+			retryAttempt.APIErrors = ParseAPIErrors(respBytes)
+		}
+	}
+
+	return retryAttempt
+}
+
+// error returns what went wrong with the attempt, for logging.
+func (attempt *RetryAttempt) error() error {
+	if attempt.Err != nil {
+		return attempt.Err
+	}
+	if attempt.APIErrors.Validate() {
+		return attempt.APIErrors
+	}
+
+	return nil
+}
+
+// failed reports whether the attempt did not succeed.
+func (attempt *RetryAttempt) failed() bool {
+	return attempt.Err != nil || attempt.StatusCode >= http.StatusBadRequest
+}
+
+// backoff reports whether the attempt should be retried and how long to wait first.
+func (policy *RetryPolicy) backoff(attempt *RetryAttempt) (time.Duration, bool) {
+	if policy == nil || attempt.Attempt >= policy.MaxAttempts || !attempt.failed() {
+		return 0, false
+	}
+	if attempt.Err == context.Canceled || attempt.Err == context.DeadlineExceeded {
+		return 0, false
+	}
+
+	shouldRetry := policy.ShouldRetry
+	if shouldRetry == nil {
+		shouldRetry = DefaultShouldRetry
+	}
+	if !shouldRetry(attempt) {
+		return 0, false
+	}
+
+	if wait, ok := retryAfter(attempt.Header); ok {
+		if policy.MaxBackoff > 0 && wait > policy.MaxBackoff {
+			wait = policy.MaxBackoff
+		}
+		return wait, true
+	}
+
+	wait := policy.MinBackoff
+	for i := 1; i < attempt.Attempt && wait < policy.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if policy.MaxBackoff > 0 && wait > policy.MaxBackoff {
+		wait = policy.MaxBackoff
+	}
+	if wait > 0 {
+		wait -= time.Duration(rand.Int63n(int64(wait)/2 + 1))
+	}
+
+	return wait, true
+}
+
+// retryAfter parses the Retry-After header, given either in seconds or as an HTTP date.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done, whichever happens first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,139 @@
+package force
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRetryTestForceApi(serverURL string) *ForceApi {
+	forceApi := newTestForceApi(serverURL)
+	forceApi.retryPolicy = &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+	}
+
+	return forceApi
+}
+
+func TestRetryTransientErrorCode(t *testing.T) {
+	fake := newFakeForce(t)
+	var calls int32
+	fake.mux.HandleFunc("/retry", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `[{"errorCode":"UNABLE_TO_LOCK_ROW","message":"unable to obtain exclusive access to this record"}]`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"001","success":true}`)
+	})
+
+	// Lock errors mean nothing was written, so even a POST is retried.
+	resp := &SObjectResponse{}
+	if err := newRetryTestForceApi(fake.URL).Post("/retry", nil, map[string]string{"Name": "x"}, resp); err != nil {
+		t.Fatalf("Expected request to succeed after retries: %v", err)
+	}
+	if calls != 3 || resp.Id != "001" {
+		t.Fatalf("Unexpected result after %v calls: %+v", calls, resp)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	fake := newFakeForce(t)
+	var calls int32
+	fake.mux.HandleFunc("/retry", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `[{"errorCode":"UNKNOWN_EXCEPTION","message":"boom"}]`)
+	})
+
+	err := newRetryTestForceApi(fake.URL).Get("/retry", nil, &map[string]interface{}{})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 attempts, got %v", calls)
+	}
+}
+
+func TestRetrySkipsNonIdempotentServerError(t *testing.T) {
+	fake := newFakeForce(t)
+	var calls int32
+	fake.mux.HandleFunc("/retry", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `[{"errorCode":"UNKNOWN_EXCEPTION","message":"boom"}]`)
+	})
+
+	err := newRetryTestForceApi(fake.URL).Post("/retry", nil, map[string]string{"Name": "x"}, &SObjectResponse{})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if calls != 1 {
+		t.Fatalf("A POST must not be replayed after an ambiguous failure, got %v attempts", calls)
+	}
+}
+
+func TestRetryCustomShouldRetry(t *testing.T) {
+	fake := newFakeForce(t)
+	var calls int32
+	fake.mux.HandleFunc("/retry", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `[{"errorCode":"MY_FLAKY_TRIGGER","message":"try again"}]`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+
+	forceApi := newRetryTestForceApi(fake.URL)
+	forceApi.retryPolicy.ShouldRetry = func(attempt *RetryAttempt) bool {
+		for _, apiErr := range attempt.APIErrors {
+			if apiErr.ErrorCode == "MY_FLAKY_TRIGGER" {
+				return true
+			}
+		}
+		return DefaultShouldRetry(attempt)
+	}
+
+	if err := forceApi.Get("/retry", nil, &map[string]interface{}{}); err != nil {
+		t.Fatalf("Expected request to succeed after retry: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 attempts, got %v", calls)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 10, MinBackoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+	header := http.Header{}
+	header.Set("Retry-After", "7")
+	wait, ok := policy.backoff(&RetryAttempt{Attempt: 1, StatusCode: http.StatusServiceUnavailable, Header: header})
+	if !ok || wait != 7*time.Second {
+		t.Fatalf("Expected Retry-After to be honored, got %v %v", wait, ok)
+	}
+
+	header.Set("Retry-After", "3600")
+	wait, ok = policy.backoff(&RetryAttempt{Attempt: 1, StatusCode: http.StatusServiceUnavailable, Header: header})
+	if !ok || wait != policy.MaxBackoff {
+		t.Fatalf("Expected Retry-After to be capped at MaxBackoff, got %v %v", wait, ok)
+	}
+
+	for attempt := 1; attempt < 10; attempt++ {
+		wait, ok := policy.backoff(&RetryAttempt{Attempt: attempt, StatusCode: http.StatusServiceUnavailable})
+		if !ok || wait <= 0 || wait > policy.MaxBackoff {
+			t.Fatalf("Unexpected backoff for attempt %v: %v %v", attempt, wait, ok)
+		}
+	}
+
+	if _, ok := policy.backoff(&RetryAttempt{Attempt: 10, StatusCode: http.StatusServiceUnavailable}); ok {
+		t.Fatal("Expected no retry once MaxAttempts is reached")
+	}
+	if _, ok := (*RetryPolicy)(nil).backoff(&RetryAttempt{Attempt: 1, StatusCode: http.StatusServiceUnavailable}); ok {
+		t.Fatal("Expected no retry without a policy")
+	}
+}
@@ -0,0 +1,101 @@
+package force
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// handleSession serves path, rejecting requests made with the given stale token.
+func handleSession(fake *fakeForce, path, staleToken string, calls *int32) {
+	fake.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") == staleToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `[{"errorCode":"INVALID_SESSION_ID","message":"Session expired or invalid"}]`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	})
+}
+
+func TestRenewSessionOnce(t *testing.T) {
+	fake := newFakeForce(t)
+	var calls int32
+	handleSession(fake, "/data", "stale", &calls)
+
+	forceApi := newTestForceApi(fake.URL)
+	forceApi.oauth.loginURI = fake.URL
+	forceApi.oauth.flow = refreshTokenFlow
+	forceApi.oauth.AccessToken = "stale"
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := map[string]interface{}{}
+			errs <- forceApi.Get("/data", nil, &out)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected request to succeed after renewing the session: %v", err)
+		}
+	}
+	if fake.tokenRequests != 1 {
+		t.Fatalf("Expected a single token request, got %v", fake.tokenRequests)
+	}
+	if forceApi.GetAccessToken() != "token-1" {
+		t.Fatalf("Unexpected access token: %v", forceApi.GetAccessToken())
+	}
+}
+
+func TestRenewSessionRejectedAgain(t *testing.T) {
+	fake := newFakeForce(t)
+	var calls int32
+	fake.mux.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `[{"errorCode":"INVALID_SESSION_ID","message":"Session expired or invalid"}]`)
+	})
+
+	forceApi := newTestForceApi(fake.URL)
+	forceApi.oauth.loginURI = fake.URL
+	forceApi.oauth.flow = passwordFlow
+
+	err := forceApi.Get("/data", nil, &map[string]interface{}{})
+	var sessionErr *SessionError
+	if !errors.As(err, &sessionErr) {
+		t.Fatalf("Expected a session error, got: %v", err)
+	}
+	if calls != 2 || fake.tokenRequests != 1 {
+		t.Fatalf("Expected the request to be retried once, got %v calls and %v token requests", calls, fake.tokenRequests)
+	}
+}
+
+func TestRenewSessionWithoutCredentials(t *testing.T) {
+	fake := newFakeForce(t)
+	var calls int32
+	handleSession(fake, "/data", "test-access-token", &calls)
+
+	forceApi := newTestForceApi(fake.URL)
+	forceApi.oauth.flow = accessTokenFlow
+
+	err := forceApi.Get("/data", nil, &map[string]interface{}{})
+	var sessionErr *SessionError
+	if !errors.As(err, &sessionErr) || !errors.Is(err, errSessionNotRenewable) {
+		t.Fatalf("Expected a session error, got: %v", err)
+	}
+	if fake.tokenRequests != 0 {
+		t.Fatalf("An access token client must not log in, got %v token requests", fake.tokenRequests)
+	}
+}
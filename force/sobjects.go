@@ -2,12 +2,10 @@ package force
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
-
-	"github.com/sirupsen/logrus"
-	"github.com/ztrue/tracerr"
 )
 
 // SObject interface all standard and custom objects must implement. Needed for uri generation.
@@ -24,12 +22,15 @@ type SObjectResponse struct {
 }
 
 func (forceAPI *ForceApi) DescribeSObjects() (map[string]*SObjectMetaData, error) {
-	if err := forceAPI.getApiSObjects(); err != nil {
-		err = tracerr.Wrap(err)
-		logrus.WithFields(logrus.Fields{
-			"forceAPI": forceAPI,
-			"err":      err,
-		}).Error("error get api sobjects")
+	return forceAPI.DescribeSObjectsContext(context.Background())
+}
+
+// DescribeSObjectsContext is like DescribeSObjects but carries a context for cancellation and deadlines.
+func (forceAPI *ForceApi) DescribeSObjectsContext(ctx context.Context) (map[string]*SObjectMetaData, error) {
+	ctx = withOperation(ctx, "describeGlobal", "")
+
+	if err := forceAPI.getApiSObjects(ctx); err != nil {
+		forceAPI.log.error("error get api sobjects", "err", err)
 		return nil, err
 	}
 
@@ -37,13 +38,20 @@ func (forceAPI *ForceApi) DescribeSObjects() (map[string]*SObjectMetaData, error
 }
 
 func (forceApi *ForceApi) DescribeSObject(in SObject) (resp *SObjectDescription, err error) {
+	return forceApi.DescribeSObjectContext(context.Background(), in)
+}
+
+// DescribeSObjectContext is like DescribeSObject but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) DescribeSObjectContext(ctx context.Context, in SObject) (resp *SObjectDescription, err error) {
+	ctx = withOperation(ctx, "describe", in.APIName())
+
 	// Check cache
 	resp, ok := forceApi.apiSObjectDescriptions[in.APIName()]
 	if !ok {
 		// Attempt retrieval from api
 		sObjectMetaData, ok := forceApi.apiSObjects[in.APIName()]
 		if !ok {
-			logrus.WithField("apiName", in.APIName()).Error("unable to find metadata")
+			forceApi.log.error("unable to find metadata", "apiName", in.APIName())
 			err = fmt.Errorf("Unable to find metadata for object: %v", in.APIName())
 			return
 		}
@@ -51,7 +59,7 @@ func (forceApi *ForceApi) DescribeSObject(in SObject) (resp *SObjectDescription,
 		uri := sObjectMetaData.URLs[sObjectDescribeKey]
 
 		resp = &SObjectDescription{}
-		err = forceApi.Get(uri, nil, resp)
+		err = forceApi.GetContext(ctx, uri, nil, resp)
 		if err != nil {
 			return
 		}
@@ -81,6 +89,13 @@ func (forceApi *ForceApi) DescribeSObject(in SObject) (resp *SObjectDescription,
 }
 
 func (forceApi *ForceApi) GetSObject(id string, fields []string, out SObject) (err error) {
+	return forceApi.GetSObjectContext(context.Background(), id, fields, out)
+}
+
+// GetSObjectContext is like GetSObject but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) GetSObjectContext(ctx context.Context, id string, fields []string, out SObject) (err error) {
+	ctx = withOperation(ctx, "get", out.APIName())
+
 	uri := strings.Replace(forceApi.apiSObjects[out.APIName()].URLs[rowTemplateKey], idKey, id, 1)
 
 	params := url.Values{}
@@ -88,69 +103,69 @@ func (forceApi *ForceApi) GetSObject(id string, fields []string, out SObject) (e
 		params.Add("fields", strings.Join(fields, ","))
 	}
 
-	err = forceApi.Get(uri, params, out.(interface{}))
-	err = tracerr.Wrap(err)
-	logrus.WithFields(logrus.Fields{
-		"id":      id,
-		"uri":     uri,
-		"param":   params,
-		"sobject": out,
-		"apiName": out.APIName(),
-		"err":     err,
-	}).Info("get sobject")
+	err = forceApi.GetContext(ctx, uri, params, out.(interface{}))
+	forceApi.log.debug("get sobject", "apiName", out.APIName(), "id", id, "uri", uri, "err", err)
 
 	return
 }
 
 func (forceApi *ForceApi) InsertSObject(in SObject) (resp *SObjectResponse, err error) {
+	return forceApi.InsertSObjectContext(context.Background(), in)
+}
+
+// InsertSObjectContext is like InsertSObject but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) InsertSObjectContext(ctx context.Context, in SObject) (resp *SObjectResponse, err error) {
+	ctx = withOperation(ctx, "insert", in.APIName())
+
 	uri := forceApi.apiSObjects[in.APIName()].URLs[sObjectKey]
 
 	resp = &SObjectResponse{}
-	err = forceApi.Post(uri, nil, in.(interface{}), resp)
-	err = tracerr.Wrap(err)
-	logrus.WithFields(logrus.Fields{
-		"uri":     uri,
-		"resp":    resp,
-		"sobject": in,
-		"apiName": in.APIName(),
-		"err":     err,
-	}).Info("insert sobject")
+	err = forceApi.PostContext(ctx, uri, nil, in.(interface{}), resp)
+	forceApi.log.debug("insert sobject", "apiName", in.APIName(), "uri", uri, "err", err)
 
 	return
 }
 
 func (forceApi *ForceApi) UpdateSObject(id string, in SObject) (err error) {
+	return forceApi.UpdateSObjectContext(context.Background(), id, in)
+}
+
+// UpdateSObjectContext is like UpdateSObject but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) UpdateSObjectContext(ctx context.Context, id string, in SObject) (err error) {
+	ctx = withOperation(ctx, "update", in.APIName())
+
 	uri := strings.Replace(forceApi.apiSObjects[in.APIName()].URLs[rowTemplateKey], idKey, id, 1)
 
-	err = forceApi.Patch(uri, nil, in.(interface{}), nil)
-	err = tracerr.Wrap(err)
-	logrus.WithFields(logrus.Fields{
-		"uri":     uri,
-		"id":      id,
-		"sobject": in,
-		"apiName": in.APIName(),
-		"err":     err,
-	}).Info("update sobject")
+	err = forceApi.PatchContext(ctx, uri, nil, in.(interface{}), nil)
+	forceApi.log.debug("update sobject", "apiName", in.APIName(), "id", id, "uri", uri, "err", err)
 
 	return
 }
 
 func (forceApi *ForceApi) DeleteSObject(id string, in SObject) (err error) {
+	return forceApi.DeleteSObjectContext(context.Background(), id, in)
+}
+
+// DeleteSObjectContext is like DeleteSObject but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) DeleteSObjectContext(ctx context.Context, id string, in SObject) (err error) {
+	ctx = withOperation(ctx, "delete", in.APIName())
+
 	uri := strings.Replace(forceApi.apiSObjects[in.APIName()].URLs[rowTemplateKey], idKey, id, 1)
 
-	err = forceApi.Delete(uri, nil)
-	err = tracerr.Wrap(err)
-	logrus.WithFields(logrus.Fields{
-		"uri":     uri,
-		"sobject": in,
-		"apiName": in.APIName(),
-		"err":     err,
-	}).Info("delete sobject")
+	err = forceApi.DeleteContext(ctx, uri, nil)
+	forceApi.log.debug("delete sobject", "apiName", in.APIName(), "uri", uri, "err", err)
 
 	return
 }
 
 func (forceApi *ForceApi) GetSObjectByExternalId(id string, fields []string, out SObject) (err error) {
+	return forceApi.GetSObjectByExternalIdContext(context.Background(), id, fields, out)
+}
+
+// GetSObjectByExternalIdContext is like GetSObjectByExternalId but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) GetSObjectByExternalIdContext(ctx context.Context, id string, fields []string, out SObject) (err error) {
+	ctx = withOperation(ctx, "getByExternalId", out.APIName())
+
 	uri := fmt.Sprintf("%v/%v/%v", forceApi.apiSObjects[out.APIName()].URLs[sObjectKey],
 		out.ExternalIdAPIName(), id)
 
@@ -159,52 +174,43 @@ func (forceApi *ForceApi) GetSObjectByExternalId(id string, fields []string, out
 		params.Add("fields", strings.Join(fields, ","))
 	}
 
-	err = forceApi.Get(uri, params, out.(interface{}))
-	err = tracerr.Wrap(err)
-	logrus.WithFields(logrus.Fields{
-		"id":      id,
-		"uri":     uri,
-		"param":   params,
-		"sobject": out,
-		"apiName": out.APIName(),
-		"err":     err,
-	}).Info("get sobject by external id")
+	err = forceApi.GetContext(ctx, uri, params, out.(interface{}))
+	forceApi.log.debug("get sobject by external id", "apiName", out.APIName(), "id", id, "uri", uri, "err", err)
 
 	return
 }
 
 func (forceApi *ForceApi) UpsertSObjectByExternalId(id string, in SObject) (resp *SObjectResponse, err error) {
+	return forceApi.UpsertSObjectByExternalIdContext(context.Background(), id, in)
+}
+
+// UpsertSObjectByExternalIdContext is like UpsertSObjectByExternalId but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) UpsertSObjectByExternalIdContext(ctx context.Context, id string, in SObject) (resp *SObjectResponse, err error) {
+	ctx = withOperation(ctx, "upsert", in.APIName())
+
 	uri := fmt.Sprintf("%v/%v/%v", forceApi.apiSObjects[in.APIName()].URLs[sObjectKey],
 		in.ExternalIdAPIName(), id)
 
 	resp = &SObjectResponse{}
-	err = forceApi.Patch(uri, nil, in.(interface{}), resp)
-	err = tracerr.Wrap(err)
-	logrus.WithFields(logrus.Fields{
-		"id":      id,
-		"uri":     uri,
-		"resp":    resp,
-		"sobject": in,
-		"apiName": in.APIName(),
-		"err":     err,
-	}).Info("upsert sobject by external id")
+	err = forceApi.PatchContext(ctx, uri, nil, in.(interface{}), resp)
+	forceApi.log.debug("upsert sobject by external id", "apiName", in.APIName(), "id", id, "uri", uri, "err", err)
 
 	return
 }
 
 func (forceApi *ForceApi) DeleteSObjectByExternalId(id string, in SObject) (err error) {
+	return forceApi.DeleteSObjectByExternalIdContext(context.Background(), id, in)
+}
+
+// DeleteSObjectByExternalIdContext is like DeleteSObjectByExternalId but carries a context for cancellation and deadlines.
+func (forceApi *ForceApi) DeleteSObjectByExternalIdContext(ctx context.Context, id string, in SObject) (err error) {
+	ctx = withOperation(ctx, "deleteByExternalId", in.APIName())
+
 	uri := fmt.Sprintf("%v/%v/%v", forceApi.apiSObjects[in.APIName()].URLs[sObjectKey],
 		in.ExternalIdAPIName(), id)
 
-	err = forceApi.Delete(uri, nil)
-	err = tracerr.Wrap(err)
-	logrus.WithFields(logrus.Fields{
-		"uri":     uri,
-		"id":      id,
-		"sobject": in,
-		"apiName": in.APIName(),
-		"err":     err,
-	}).Info("delete sobject by external id")
+	err = forceApi.DeleteContext(ctx, uri, nil)
+	forceApi.log.debug("delete sobject by external id", "apiName", in.APIName(), "id", id, "uri", uri, "err", err)
 
 	return
 }
@@ -1,16 +1,16 @@
 package force
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/sirupsen/logrus"
 	"golang.org/x/net/publicsuffix"
 )
 
@@ -18,11 +18,44 @@ import (
 type StreamsForce struct {
 	APIForce       *ForceApi
 	ClientID       string
-	Subscribes     map[string]func([]byte, ...interface{})
 	Timeout        int
 	LongPoolClient *http.Client
+
+	// mu guards the fields below, subscribeMu serializes subscribing and unsubscribing.
+	mu            sync.Mutex
+	subscribeMu   sync.Mutex
+	advice        bayeuxAdvice
+	messageID     int64
+	subscriptions map[string][]*Subscription
+	replayIDs     map[string]int64
+	gaps          map[string]*replayGap
+	generation    int64
+	workers       *streamWorkers
+	ctx           context.Context
+	cancel        context.CancelFunc
+	stopped       chan struct{}
+}
+
+// ErrStreamingNotConnected is returned by streaming operations called before
+// ConnectToStreamingAPI or after DisconnectStreamingAPI.
+var ErrStreamingNotConnected = errors.New("not connected to the streaming api")
+
+// ErrStreamingConnected is returned by ConnectToStreamingAPI when the ForceApi is
+// connected already.
+var ErrStreamingConnected = errors.New("already connected to the streaming api")
+
+// WithStreamingErrorHandler sets the function the background loop of the streaming client
+// passes its failures to. Without one, failures are logged.
+func WithStreamingErrorHandler(handler func(err error)) Option {
+	return func(o *options) {
+		o.onStreamError = handler
+	}
 }
 
+// streamRetryDelay is how much longer the streaming loop waits before polling again after
+// each consecutive failed connect or handshake.
+var streamRetryDelay = time.Second
+
 //CometdVersion global var
 var (
 	CometdVersion string = "40.0"
@@ -33,186 +66,209 @@ var (
 	}
 )
 
-func (s *StreamsForce) httpPost(payload string) (*http.Response, error) {
-	ioPayload := strings.NewReader(payload)
-	endpoint := s.APIForce.oauth.InstanceUrl + "/cometd/" + CometdVersion
-	headerVal := "OAuth " + s.APIForce.oauth.AccessToken
+// httpPost posts payload to the CometD endpoint, returning the access token it was sent
+// with along with the response.
+func (s *StreamsForce) httpPost(ctx context.Context, channel string, payload []byte) (*http.Response, string, error) {
+	accessToken, instanceUrl := s.APIForce.oauth.session()
+	endpoint := instanceUrl + "/cometd/" + CometdVersion
+	headerVal := "OAuth " + accessToken
 
-	request, _ := http.NewRequest("POST", endpoint, ioPayload)
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Authorization", headerVal)
-	logrus.WithFields(logrus.Fields{
-		"payload":  ioPayload,
-		"endpoint": endpoint,
-		"header":   headerVal,
-		"request":  request,
-	}).Info("http post stream")
-
-	resp, err := s.LongPoolClient.Do(request)
-	logrus.WithFields(logrus.Fields{
-		"request":  request,
-		"response": resp,
-		"err":      err,
-	}).Info("long pool client do")
+	ctx = withOperation(withCallKind(ctx, StreamingCall), strings.TrimPrefix(channel, "/meta/"), "")
 
-	return resp, err
-}
-
-func (s *StreamsForce) performTask(params string) ([]byte, error) {
-	resp, err := s.httpPost(params)
+	request, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
 	if err != nil {
-		log.Fatal(err)
+		return nil, accessToken, err
 	}
+	request.Header.Set("User-Agent", s.APIForce.agent())
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", headerVal)
+	s.APIForce.log.debug("http post stream", "endpoint", endpoint, "channel", channel)
 
-	respBytes, err := ioutil.ReadAll(resp.Body)
+	resp, err := s.LongPoolClient.Do(request)
 	if err != nil {
-		log.Fatal(err)
+		s.APIForce.log.error("error long pool client do", "endpoint", endpoint, "err", err)
 	}
 
-	defer resp.Body.Close()
-
-	logrus.WithFields(logrus.Fields{
-		"param":    params,
-		"resp":     resp,
-		"respBody": string(respBytes),
-		"err":      err,
-	}).Info("perform task")
-
-	return respBytes, err
-}
-
-func (s *StreamsForce) connect() ([]byte, error) {
-	connectParams := `{ "channel": "/meta/connect", "clientId": "` + s.ClientID + `", "connectionType": "long-polling"}`
-	return s.performTask(connectParams)
-}
-
-func (s *StreamsForce) handshake() ([]byte, error) {
-	handshakeParams := `{"channel":"/meta/handshake", "supportedConnectionTypes":["long-polling"], "version":"1.0"}`
-	return s.performTask(handshakeParams)
+	return resp, accessToken, err
 }
 
-func (s *StreamsForce) disconnect() ([]byte, error) {
-	connectParams := `{ "channel": "/meta/disconnect", "clientId": "` + s.ClientID + `", "connectionType": "long-polling"}`
-	return s.performTask(connectParams)
-}
+// ConnectToStreamingAPI handshakes with the streaming API and keeps polling for messages
+// in the background until DisconnectStreamingAPI is called. The background loop follows
+// the reconnect advice of the server and handshakes again, restoring the subscriptions,
+// when the server no longer knows the client. Its failures are passed to the handler set
+// with WithStreamingErrorHandler. It returns ErrStreamingConnected until the previous
+// connection is closed with DisconnectStreamingAPI.
+func (forceAPI *ForceApi) ConnectToStreamingAPI() error {
+	if forceAPI.streaming() != nil {
+		return ErrStreamingConnected
+	}
 
-//ConnectToStreamingAPI connects to streaming API
-func (forceAPI *ForceApi) ConnectToStreamingAPI() {
 	//set up the client
 	cookiejarOptions := cookiejar.Options{
 		PublicSuffixList: publicsuffix.List,
 	}
 	jar, err := cookiejar.New(&cookiejarOptions)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	forceAPI.stream = &StreamsForce{
+	// Share the configured transport, but keep the streaming session cookies to ourselves
+	// and let long polls outlive any client timeout.
+	longPoolClient := *forceAPI.client()
+	longPoolClient.Jar = jar
+	longPoolClient.Timeout = 0
+
+	stream := &StreamsForce{
 		APIForce:       forceAPI,
 		ClientID:       "",
-		Subscribes:     map[string]func([]byte, ...interface{}){},
 		Timeout:        0,
-		LongPoolClient: &http.Client{Jar: jar},
+		LongPoolClient: &longPoolClient,
+		subscriptions:  make(map[string][]*Subscription),
+		replayIDs:      make(map[string]int64),
+		gaps:           make(map[string]*replayGap),
+		stopped:        make(chan struct{}),
 	}
+	stream.ctx, stream.cancel = context.WithCancel(context.Background())
 
-	//handshake
-	handshakeBytes, err := forceAPI.stream.handshake()
+	if err := stream.handshake(stream.ctx); err != nil {
+		stream.cancel()
+		return err
+	}
+
+	msgs, err := stream.connect(stream.ctx)
 	if err != nil {
-		log.Fatal("Handshake failed! Err = ", err)
+		stream.cancel()
+		return err
+	}
+	// Another caller may have connected meanwhile.
+	forceAPI.streamMu.Lock()
+	if forceAPI.stream != nil {
+		forceAPI.streamMu.Unlock()
+		stream.cancel()
+		stream.disconnect(context.Background())
+		return ErrStreamingConnected
+	}
+	if forceAPI.streamWorkers != nil {
+		stream.workers = newStreamWorkers(stream, *forceAPI.streamWorkers)
 	}
-	var data []map[string]interface{}
-	json.Unmarshal(handshakeBytes, &data)
+	forceAPI.stream = stream
+	forceAPI.streamMu.Unlock()
+	stream.dispatch(msgs)
 
-	//DEBUG ONLY (DELETE LATER)
-	fmt.Println(data)
+	go stream.run()
 
-	forceAPI.stream.ClientID = data[0][clientIDParam].(string)
+	return nil
+}
 
-	//connect
-	connBytes, err := forceAPI.stream.connect()
-	if err != nil {
-		log.Fatal("Connect failed! Err = ", err)
-	}
-	var connectData []map[string]interface{}
-	json.Unmarshal(connBytes, &connectData)
-	for _, msg := range data {
-		cb := forceAPI.stream.Subscribes[msg[channelParam].(string)]
-		if cb != nil {
-			cb(connBytes)
-		}
+// reportError passes err to the streaming error handler, or logs it when there is none.
+func (s *StreamsForce) reportError(err error) {
+	if s.APIForce.onStreamError != nil {
+		s.APIForce.onStreamError(err)
+		return
 	}
 
-	//DEBUG ONLY (DELETE LATER)
-	fmt.Println(string(connBytes))
-
-	go func() {
-		for {
-			connBytes, err = forceAPI.stream.connect()
-			if err != nil {
-				log.Fatal("Connect failed! Err = ", err)
-			}
-			json.Unmarshal(connBytes, &connectData)
-			for _, msg := range connectData {
-				cb := forceAPI.stream.Subscribes[msg[channelParam].(string)]
-				if cb != nil {
-					cb(connBytes)
-				}
-			}
-		}
-	}()
-
+	s.APIForce.log.error("streaming api", "err", err)
 }
 
-func (forceAPI *ForceApi) DisconnectStreamingAPI() {
-	connByte, err := forceAPI.stream.disconnect()
-	if err != nil {
-		log.Fatal("Disconnect failed! Err = ", err)
+// DisconnectStreamingAPI disconnects from the streaming API and stops the background loop,
+// after the messages queued for the streaming workers have been handled.
+func (forceAPI *ForceApi) DisconnectStreamingAPI() error {
+	forceAPI.streamMu.Lock()
+	stream := forceAPI.stream
+	forceAPI.stream = nil
+	forceAPI.streamMu.Unlock()
+	if stream == nil {
+		return ErrStreamingNotConnected
 	}
 
-	logrus.WithFields(logrus.Fields{
-		"response": string(connByte),
-		"err":      err,
-	}).Info("disconnect streaming api")
+	stream.cancel()
+	<-stream.stopped
+	if stream.workers != nil {
+		stream.workers.stop()
+	}
+
+	_, err := stream.disconnect(context.Background())
+	forceAPI.log.debug("disconnect streaming api", "err", err)
+
+	return err
 }
 
-func getTopic(mode, topic string) string {
+// streaming returns the streaming client, or nil when not connected.
+func (forceAPI *ForceApi) streaming() *StreamsForce {
+	forceAPI.streamMu.Lock()
+	defer forceAPI.streamMu.Unlock()
+
+	return forceAPI.stream
+}
+
+func getTopic(mode, topic string) (string, error) {
 	topicMode, ok := TopicMode[mode]
 	if !ok {
-		log.Fatal("Invalid mode!")
+		return "", fmt.Errorf("invalid topic mode %q", mode)
 	}
-	return fmt.Sprintf(topicMode, topic)
+	return fmt.Sprintf(topicMode, topic), nil
 }
 
-//Subscribe receives message from any mode such as:
+// Subscribe receives message from any mode such as:
 // "CDC" : Change Data Capture
 // "PushTopic" : Push Topic
 // "Event" : Event
+// The callback is called with each message delivered on the topic, as received, and the
+// reply of the server to the subscription is returned. SubscribeFunc and SubscribeChan
+// deliver decoded messages instead. Subscriptions are restored after the client
+// handshakes again, from the last event processed. Without a replay id in the ReplayStore,
+// only the events published from now on are delivered.
 func (forceAPI *ForceApi) Subscribe(mode, topic string, callback func([]byte, ...interface{})) ([]byte, error) {
-	//Get topic by mode
-	topicString := getTopic(mode, topic)
-	subscribeParams := `{ "channel": "/meta/subscribe", "clientId": "` + forceAPI.stream.ClientID + `", "subscription": "` + topicString + `"}`
-
-	subscribeBytes, err := forceAPI.stream.performTask(subscribeParams)
-	if err != nil {
-		log.Fatal(err)
-	}
-	forceAPI.stream.Subscribes[topicString] = callback
+	return forceAPI.SubscribeWithReplay(mode, topic, ReplayNewEvents, callback)
+}
 
-	return subscribeBytes, err
+// SubscribeWithReplay is like Subscribe but delivers the events from replayID on when the
+// ReplayStore holds no replay id for the topic. replayID is the replay id of an event, or
+// ReplayNewEvents or ReplayAllEvents.
+func (forceAPI *ForceApi) SubscribeWithReplay(mode, topic string, replayID int64,
+	callback func([]byte, ...interface{})) ([]byte, error) {
+	sub := &Subscription{handler: func(msg *Message) error {
+		callback(msg.raw)
+		return nil
+	}}
+	_, reply, err := forceAPI.subscribeTopic(mode, topic, sub, []SubscribeOption{ReplayFrom(replayID)})
+
+	return reply, err
 }
 
+// Unsubscribe removes every subscription to a topic of the given mode.
 func (forceAPI *ForceApi) Unsubscribe(mode, topic string) error {
-	topicString := getTopic(mode, topic)
-	if _, ok := forceAPI.stream.Subscribes[topicString]; !ok {
-		return errors.New("this topic hasn't been subscribed")
+	stream := forceAPI.streaming()
+	if stream == nil {
+		return ErrStreamingNotConnected
 	}
 
-	unsubscribeParams := `{ "channel": "/meta/unsubscribe", "clientId": "` + forceAPI.stream.ClientID + `", "subscription": "` + topicString + `"}`
-	_, err := forceAPI.stream.performTask(unsubscribeParams)
+	topicString, err := getTopic(mode, topic)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	stream.mu.Lock()
+	subs := stream.subscriptions[topicString]
+	stream.mu.Unlock()
+	if len(subs) == 0 {
+		return errors.New("this topic hasn't been subscribed")
+	}
+
+	for _, sub := range subs {
+		if err := sub.Unsubscribe(); err != nil {
+			return err
+		}
 	}
 
-	delete(forceAPI.stream.Subscribes, topicString)
+	return nil
+}
+
+// metaReplyBytes returns the reply on channel among msgs as received.
+func metaReplyBytes(channel string, msgs []*bayeuxMessage) []byte {
+	for _, msg := range msgs {
+		if msg.Channel == channel {
+			return msg.raw
+		}
+	}
 	return nil
 }
 
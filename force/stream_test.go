@@ -0,0 +1,95 @@
+package force
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamingErrors(t *testing.T) {
+	defer func(delay time.Duration) { streamRetryDelay = delay }(streamRetryDelay)
+	streamRetryDelay = time.Millisecond
+
+	cometd := newFakeCometd(t)
+	errs := make(chan error, 100)
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.onStreamError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	if _, err := forceApi.Subscribe("Event", "Test__e", nil); err != ErrStreamingNotConnected {
+		t.Fatalf("Expected subscribing before connecting to fail, got %v", err)
+	}
+
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+
+	cometd.mu.Lock()
+	cometd.connectStatus = http.StatusInternalServerError
+	cometd.subscribeErr = "403:/event/Test__e:topic not found"
+	cometd.mu.Unlock()
+
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "500") {
+			t.Fatalf("Unexpected streaming error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the failed connect to be reported")
+	}
+
+	if _, err := forceApi.Subscribe("Invalid", "Test__e", nil); err == nil {
+		t.Fatal("Expected an invalid topic mode to fail")
+	}
+	if _, err := forceApi.Subscribe("Event", "Test__e", nil); err == nil || !strings.Contains(err.Error(), "topic not found") {
+		t.Fatalf("Expected the failed subscription to be returned, got %v", err)
+	}
+	if err := forceApi.Unsubscribe("Event", "Test__e"); err == nil {
+		t.Fatal("Expected unsubscribing from an unknown topic to fail")
+	}
+
+	if err := forceApi.DisconnectStreamingAPI(); err != nil {
+		t.Fatalf("Unable to disconnect: %v", err)
+	}
+	if err := forceApi.DisconnectStreamingAPI(); err != ErrStreamingNotConnected {
+		t.Fatalf("Expected disconnecting twice to fail, got %v", err)
+	}
+}
+
+func TestStreamingHandshakeFailure(t *testing.T) {
+	cometd := newFakeCometd(t)
+	cometd.token = "valid"
+
+	forceApi := newTestForceApi(cometd.URL)
+	if err := forceApi.ConnectToStreamingAPI(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("Expected the failed handshake to be returned, got %v", err)
+	}
+	if forceApi.stream != nil {
+		t.Fatal("Expected no stream after a failed handshake")
+	}
+}
+
+func TestStreamingConnectTwice(t *testing.T) {
+	cometd := newFakeCometd(t)
+	forceApi := connectTestStream(t, cometd, nil)
+	stream := forceApi.streaming()
+
+	if err := forceApi.ConnectToStreamingAPI(); err != ErrStreamingConnected {
+		t.Fatalf("Expected connecting twice to fail, got %v", err)
+	}
+	if forceApi.streaming() != stream || len(cometd.sent(metaHandshake)) != 1 {
+		t.Fatal("Expected the first connection to be kept")
+	}
+
+	if err := forceApi.DisconnectStreamingAPI(); err != nil {
+		t.Fatalf("Unable to disconnect: %v", err)
+	}
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Expected to connect again after disconnecting, got %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+package force
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Message is an event delivered on a streaming channel. Handlers share the message and
+// must not modify it.
+type Message struct {
+	Channel string
+
+	// ReplayID is the replay id of the event, or 0 for messages without one such as
+	// generic streaming events.
+	ReplayID int64
+	Data     json.RawMessage
+
+	// raw is the Bayeux message as received, passed to legacy callbacks.
+	raw json.RawMessage
+	// generation tells the messages delivered before and after a channel was subscribed
+	// again apart, see resubscribed.
+	generation int64
+}
+
+func newMessage(msg *bayeuxMessage) *Message {
+	replayID, _ := eventReplayID(msg.Data)
+
+	return &Message{
+		Channel:  msg.Channel,
+		ReplayID: replayID,
+		Data:     msg.Data,
+		raw:      msg.raw,
+	}
+}
+
+// ChangeEvent decodes the message as a Change Data Capture event.
+func (msg *Message) ChangeEvent() (*ChangeEvent, error) {
+	return decodeChangeEvent(msg.Channel, msg.ReplayID, msg.Data)
+}
+
+// HandlerError is reported to the streaming error handler for a message a handler failed
+// on. Like a dropped message, it is delivered again, to every subscription of its channel,
+// and the replay position of the channel stays before it until it has been handled.
+type HandlerError struct {
+	Message *Message
+	Err     error
+}
+
+func (err *HandlerError) Error() string {
+	return fmt.Sprintf("handler failed on message %v on %v: %v", err.Message.ReplayID, err.Message.Channel, err.Err)
+}
+
+func (err *HandlerError) Unwrap() error {
+	return err.Err
+}
+
+// SubscribeOption configures a subscription made with SubscribeFunc or SubscribeChan.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	replayID int64
+}
+
+// ReplayFrom delivers the events from replayID on when the ReplayStore holds no replay id
+// for the channel. replayID is the replay id of an event, or ReplayNewEvents or
+// ReplayAllEvents. It only applies to the first subscription to a channel; later ones
+// receive the messages from the position the channel is at.
+func ReplayFrom(replayID int64) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.replayID = replayID
+	}
+}
+
+// Subscription is a handle on a subscription to a streaming channel. Any number of
+// subscriptions can share a channel; each receives every message.
+type Subscription struct {
+	stream  *StreamsForce
+	channel string
+
+	handler  func(msg *Message) error
+	messages chan<- *Message
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Channel returns the channel the subscription receives the messages of, e.g.
+// "/data/AccountChangeEvent".
+func (sub *Subscription) Channel() string {
+	return sub.channel
+}
+
+// Unsubscribe stops the delivery of messages to the subscription. The client unsubscribes
+// from the channel once its last subscription is gone. Unsubscribing twice is a no-op.
+func (sub *Subscription) Unsubscribe() error {
+	_, err := sub.stream.remove(sub)
+	return err
+}
+
+// deliver passes msg to the handler or channel of the subscription. Sending on a full
+// channel blocks until there is room, the subscription is closed or the client
+// disconnects. It reports false when the handler failed, or the client disconnected
+// before msg was sent.
+func (sub *Subscription) deliver(msg *Message) bool {
+	select {
+	case <-sub.closed:
+		return true
+	default:
+	}
+
+	if sub.handler != nil {
+		if err := sub.handler(msg); err != nil {
+			sub.stream.dropped(msg, &HandlerError{Message: msg, Err: err})
+			return false
+		}
+		return true
+	}
+
+	select {
+	case sub.messages <- msg:
+	case <-sub.closed:
+	case <-sub.stream.ctx.Done():
+		return false
+	}
+	return true
+}
+
+func (sub *Subscription) close() {
+	sub.closeOnce.Do(func() { close(sub.closed) })
+}
+
+// SubscribeFunc subscribes handler to a topic of the given mode, see Subscribe. The
+// handler is called with one message at a time, from the streaming loop.
+func (forceAPI *ForceApi) SubscribeFunc(mode, topic string, handler func(msg *Message),
+	opts ...SubscribeOption) (*Subscription, error) {
+	return forceAPI.SubscribeFuncErr(mode, topic, func(msg *Message) error {
+		handler(msg)
+		return nil
+	}, opts...)
+}
+
+// SubscribeFuncErr is like SubscribeFunc, but the replay id of a message is not saved when
+// handler returns an error. The error is reported as a HandlerError, and the message is
+// delivered again.
+func (forceAPI *ForceApi) SubscribeFuncErr(mode, topic string, handler func(msg *Message) error,
+	opts ...SubscribeOption) (*Subscription, error) {
+	sub, _, err := forceAPI.subscribeTopic(mode, topic, &Subscription{handler: handler}, opts)
+	return sub, err
+}
+
+// SubscribeChan subscribes to a topic of the given mode, see Subscribe, sending each
+// message on messages. The channel is not closed by the client. A message counts as
+// handled once it is sent on messages: its replay id may be saved before it is read, so
+// a consumer that must not lose messages across a restart subscribes with
+// SubscribeFuncErr instead.
+func (forceAPI *ForceApi) SubscribeChan(mode, topic string, messages chan<- *Message,
+	opts ...SubscribeOption) (*Subscription, error) {
+	sub, _, err := forceAPI.subscribeTopic(mode, topic, &Subscription{messages: messages}, opts)
+	return sub, err
+}
+
+func (forceAPI *ForceApi) subscribeTopic(mode, topic string, sub *Subscription,
+	opts []SubscribeOption) (*Subscription, []byte, error) {
+	stream := forceAPI.streaming()
+	if stream == nil {
+		return nil, nil, ErrStreamingNotConnected
+	}
+
+	channel, err := getTopic(mode, topic)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o := &subscribeOptions{replayID: ReplayNewEvents}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	sub.stream = stream
+	sub.channel = channel
+	sub.closed = make(chan struct{})
+
+	reply, err := stream.add(sub, o.replayID)
+	if err != nil {
+		return nil, reply, err
+	}
+
+	return sub, reply, nil
+}
+
+// add registers sub, subscribing to its channel from replayID, or the stored replay id,
+// when it is the first subscription to the channel. It returns the reply of the server.
+func (s *StreamsForce) add(sub *Subscription, replayID int64) ([]byte, error) {
+	s.subscribeMu.Lock()
+	defer s.subscribeMu.Unlock()
+
+	s.mu.Lock()
+	subs, subscribed := s.subscriptions[sub.channel]
+	if subscribed {
+		s.subscriptions[sub.channel] = append(subs[:len(subs):len(subs)], sub)
+	}
+	s.mu.Unlock()
+	if subscribed {
+		return nil, nil
+	}
+
+	replayID, err := s.startReplayID(context.Background(), sub.channel, replayID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Register the subscription first, so that a handshake happening meanwhile restores
+	// it.
+	s.mu.Lock()
+	s.subscriptions[sub.channel] = []*Subscription{sub}
+	s.replayIDs[sub.channel] = replayID
+	s.mu.Unlock()
+
+	msgs, err := s.subscribe(context.Background(), sub.channel)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.subscriptions, sub.channel)
+		delete(s.replayIDs, sub.channel)
+		s.mu.Unlock()
+	}
+
+	return metaReplyBytes(metaSubscribe, msgs), err
+}
+
+// remove unregisters sub, unsubscribing from its channel when it was the last subscription
+// to it. It reports whether sub was registered.
+func (s *StreamsForce) remove(sub *Subscription) (bool, error) {
+	s.subscribeMu.Lock()
+	defer s.subscribeMu.Unlock()
+
+	s.mu.Lock()
+	subs := s.subscriptions[sub.channel]
+	remaining := make([]*Subscription, 0, len(subs))
+	for _, other := range subs {
+		if other != sub {
+			remaining = append(remaining, other)
+		}
+	}
+	found := len(remaining) != len(subs)
+	if len(remaining) != 0 {
+		s.subscriptions[sub.channel] = remaining
+	} else if found {
+		delete(s.subscriptions, sub.channel)
+		delete(s.replayIDs, sub.channel)
+		delete(s.gaps, sub.channel)
+	}
+	s.mu.Unlock()
+
+	sub.close()
+	if !found || len(remaining) != 0 {
+		return found, nil
+	}
+
+	_, err := s.unsubscribe(context.Background(), sub.channel)
+	return found, err
+}
+
+// subscribed returns the channels with subscriptions.
+func (s *StreamsForce) subscribed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := make([]string, 0, len(s.subscriptions))
+	for channel := range s.subscriptions {
+		channels = append(channels, channel)
+	}
+
+	return channels
+}
+
+// dispatch passes every delivered message with subscriptions to the workers, or handles it
+// right away without them.
+func (s *StreamsForce) dispatch(msgs []*bayeuxMessage) {
+	for _, msg := range msgs {
+		s.mu.Lock()
+		subscribed := len(s.subscriptions[msg.Channel]) != 0
+		generation := s.generation
+		s.mu.Unlock()
+		if !subscribed {
+			continue
+		}
+
+		message := newMessage(msg)
+		message.generation = generation
+		if s.workers != nil {
+			s.workers.enqueue(message)
+		} else {
+			s.handle(message)
+		}
+	}
+}
+
+// handle passes msg to the subscriptions of its channel, and moves the replay position of
+// the channel past it once they have all handled it.
+func (s *StreamsForce) handle(msg *Message) {
+	s.mu.Lock()
+	subs := s.subscriptions[msg.Channel]
+	s.mu.Unlock()
+
+	handled := true
+	for _, sub := range subs {
+		if !sub.deliver(msg) {
+			handled = false
+		}
+	}
+	if handled {
+		s.processed(msg)
+	}
+}
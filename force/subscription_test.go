@@ -0,0 +1,230 @@
+package force
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func expectMessage(t *testing.T, messages <-chan *Message, replayID int64) {
+	t.Helper()
+
+	select {
+	case msg := <-messages:
+		if msg.Channel != "/event/Order__e" || msg.ReplayID != replayID ||
+			string(msg.Data) != fmt.Sprintf(`{"event":{"replayId":%d}}`, replayID) {
+			t.Fatalf("Unexpected message: %v %v %s", msg.Channel, msg.ReplayID, msg.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected message %v to be delivered", replayID)
+	}
+}
+
+// publishOrder publishes an order event for each replay id, delivered with one connect.
+func publishOrder(cometd *fakeCometd, replayIDs ...int64) {
+	data := make([]string, len(replayIDs))
+	for i, replayID := range replayIDs {
+		data[i] = fmt.Sprintf(`{"event":{"replayId":%d}}`, replayID)
+	}
+	cometd.publish("/event/Order__e", data...)
+}
+
+func TestSubscriptions(t *testing.T) {
+	cometd := newFakeCometd(t)
+	forceApi := connectTestStream(t, cometd, nil)
+
+	handled := make(chan *Message, 10)
+	first, err := forceApi.SubscribeFunc("Event", "Order__e", func(msg *Message) { handled <- msg })
+	if err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+	second, err := forceApi.SubscribeFunc("Event", "Order__e", func(msg *Message) { handled <- msg })
+	if err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+	received := make(chan *Message, 10)
+	third, err := forceApi.SubscribeChan("Event", "Order__e", received)
+	if err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+	if third.Channel() != "/event/Order__e" || len(cometd.sent(metaSubscribe)) != 1 {
+		t.Fatalf("Expected one subscription to %v, got %v", third.Channel(), len(cometd.sent(metaSubscribe)))
+	}
+
+	publishOrder(cometd, 1)
+	expectMessage(t, handled, 1)
+	expectMessage(t, handled, 1)
+	expectMessage(t, received, 1)
+
+	if err := first.Unsubscribe(); err != nil {
+		t.Fatalf("Unable to unsubscribe: %v", err)
+	}
+	if err := first.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribing twice should succeed: %v", err)
+	}
+
+	publishOrder(cometd, 2)
+	expectMessage(t, handled, 2)
+	expectMessage(t, received, 2)
+	if len(handled) != 0 {
+		t.Fatal("Expected no message for the closed subscription")
+	}
+
+	second.Unsubscribe()
+	if len(cometd.sent(metaUnsubscribe)) != 0 {
+		t.Fatal("Expected the channel to stay subscribed while it has subscriptions")
+	}
+	third.Unsubscribe()
+	if len(cometd.sent(metaUnsubscribe)) != 1 {
+		t.Fatal("Expected the channel to be unsubscribed with its last subscription")
+	}
+}
+
+func TestSubscribeChanBlocked(t *testing.T) {
+	cometd := newFakeCometd(t)
+	forceApi := connectTestStream(t, cometd, nil)
+
+	blocked, err := forceApi.SubscribeChan("Event", "Order__e", make(chan *Message))
+	if err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+	handled := make(chan *Message, 10)
+	if _, err := forceApi.SubscribeFunc("Event", "Order__e", func(msg *Message) { handled <- msg }); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	publishOrder(cometd, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	// Closing the subscription nobody reads from releases the streaming loop.
+	if err := blocked.Unsubscribe(); err != nil {
+		t.Fatalf("Unable to unsubscribe: %v", err)
+	}
+	expectMessage(t, handled, 1)
+}
+
+func TestSubscriptionsConcurrent(t *testing.T) {
+	cometd := newFakeCometd(t)
+	forceApi := connectTestStream(t, cometd, nil)
+
+	handled := make(chan *Message, 1000)
+	if _, err := forceApi.SubscribeFunc("Event", "Order__e", func(msg *Message) { handled <- msg }); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				sub, err := forceApi.SubscribeFunc("Event", "Order__e", func(*Message) {})
+				if err != nil {
+					t.Errorf("Unable to subscribe: %v", err)
+					return
+				}
+				if err := sub.Unsubscribe(); err != nil {
+					t.Errorf("Unable to unsubscribe: %v", err)
+				}
+			}
+		}()
+	}
+	for replayID := int64(1); replayID <= 10; replayID++ {
+		publishOrder(cometd, replayID)
+	}
+	wg.Wait()
+
+	for replayID := int64(1); replayID <= 10; replayID++ {
+		expectMessage(t, handled, replayID)
+	}
+}
+
+func TestSubscribeFuncErr(t *testing.T) {
+	cometd := newFakeCometd(t)
+	cometd.retain = true
+	store := NewMemoryReplayStore()
+	errs := make(chan error, 10)
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.replayStore = store
+	forceApi.onStreamError = func(err error) { errs <- err }
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer forceApi.DisconnectStreamingAPI()
+
+	errBusy := errors.New("busy")
+	failed := false
+	handled := make(chan *Message, 10)
+	if _, err := forceApi.SubscribeFuncErr("Event", "Order__e", func(msg *Message) error {
+		if msg.ReplayID == 2 && !failed {
+			failed = true
+			return errBusy
+		}
+		handled <- msg
+		return nil
+	}); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	publishOrder(cometd, 1, 2, 3)
+	expectMessage(t, handled, 1)
+	expectMessage(t, handled, 3)
+	select {
+	case err := <-errs:
+		var handlerErr *HandlerError
+		if !errors.As(err, &handlerErr) || handlerErr.Message.ReplayID != 2 || !errors.Is(err, errBusy) {
+			t.Fatalf("Expected the failed message to be reported, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the failed message to be reported")
+	}
+
+	// The failed message is delivered again, and the replay id is saved once it is handled.
+	expectMessage(t, handled, 2)
+	expectMessage(t, handled, 3)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		saved, _ := store.Load(context.Background(), "/event/Order__e")
+		if saved == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the replay id to be saved once the failed message was handled, got %v", saved)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubscribeChanCommitsOnSend(t *testing.T) {
+	cometd := newFakeCometd(t)
+	store := NewMemoryReplayStore()
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.replayStore = store
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer forceApi.DisconnectStreamingAPI()
+
+	received := make(chan *Message, 10)
+	if _, err := forceApi.SubscribeChan("Event", "Order__e", received); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	// The replay id is saved once the message is in the channel, before it is read.
+	publishOrder(cometd, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		saved, _ := store.Load(context.Background(), "/event/Order__e")
+		if saved == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the replay id to be saved once the message was sent, got %v", saved)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	expectMessage(t, received, 1)
+}
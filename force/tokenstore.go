@@ -0,0 +1,175 @@
+package force
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrTokenNotFound is returned by a TokenStore that holds no token for a key.
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore persists sessions so that processes using the same credentials can share one
+// login instead of each authenticating on startup. A ForceApi loads the stored session
+// before authenticating, saves every new session, and invalidates sessions that
+// Salesforce rejects.
+type TokenStore interface {
+	// Load returns the stored token for key, or ErrTokenNotFound.
+	Load(ctx context.Context, key string) (*Token, error)
+	Save(ctx context.Context, key string, token *Token) error
+	Invalidate(ctx context.Context, key string) error
+}
+
+// WithTokenStore shares sessions through store. The key identifies the session in the
+// store; when empty it is derived from the login URL, client id and user name, or the
+// refresh token for clients without a user name.
+func WithTokenStore(store TokenStore, key string) Option {
+	return func(o *options) {
+		o.tokenStore = store
+		o.tokenStoreKey = key
+	}
+}
+
+// defaultTokenStoreKey identifies the session of a set of credentials. Refresh tokens and
+// sessions from the web server flow carry no user name, so the user is told apart by a
+// hash of the refresh token, or else by the identity url of the session.
+func (oauth *forceOauth) defaultTokenStoreKey() string {
+	user := oauth.userName
+	switch {
+	case len(oauth.refreshToken) != 0:
+		hashed := sha256.Sum256([]byte(oauth.refreshToken))
+		user = "refresh:" + hex.EncodeToString(hashed[:])
+	case len(user) == 0:
+		user = oauth.Id
+	}
+
+	return oauth.clientId + ":" + user + "@" + oauth.loginURI
+}
+
+// MemoryTokenStore keeps tokens in memory. It lets several ForceApi instances in one
+// process share a session.
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]Token
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]Token)}
+}
+
+func (store *MemoryTokenStore) Load(ctx context.Context, key string) (*Token, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	token, ok := store.tokens[key]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	return &token, nil
+}
+
+func (store *MemoryTokenStore) Save(ctx context.Context, key string, token *Token) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.tokens[key] = *token
+	return nil
+}
+
+func (store *MemoryTokenStore) Invalidate(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.tokens, key)
+	return nil
+}
+
+// FileTokenStore keeps each token in a JSON file in Dir, readable only by the current user.
+// It lets processes on the same host share a session.
+type FileTokenStore struct {
+	Dir string
+}
+
+func NewFileTokenStore(dir string) (*FileTokenStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileTokenStore{Dir: dir}, nil
+}
+
+// path returns the file for key. Keys are hashed since they contain user names and URLs.
+func (store *FileTokenStore) path(key string) string {
+	return hashedPath(store.Dir, key)
+}
+
+func (store *FileTokenStore) Load(ctx context.Context, key string) (*Token, error) {
+	tokenBytes, err := ioutil.ReadFile(store.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{}
+	if err := json.Unmarshal(tokenBytes, token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Save writes the token atomically, so that readers never see a partial token.
+func (store *FileTokenStore) Save(ctx context.Context, key string, token *Token) error {
+	tokenBytes, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(store.path(key), tokenBytes)
+}
+
+func (store *FileTokenStore) Invalidate(ctx context.Context, key string) error {
+	err := os.Remove(store.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// hashedPath returns the JSON file in dir for key, named after the hash of the key so that
+// any key makes a valid file name without revealing it.
+func hashedPath(dir, key string) string {
+	hashed := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(hashed[:])+".json")
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it to path, so
+// that readers and crashes never leave a partial file behind. The file is only readable
+// by the current user.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,160 @@
+package force
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func testTokenStore(t *testing.T, store TokenStore) {
+	ctx := context.Background()
+
+	if _, err := store.Load(ctx, "key"); err != ErrTokenNotFound {
+		t.Fatalf("Expected ErrTokenNotFound, got: %v", err)
+	}
+
+	token := &Token{AccessToken: "access", InstanceUrl: "https://na1.salesforce.com", IssuedAt: "1600000000000"}
+	if err := store.Save(ctx, "key", token); err != nil {
+		t.Fatalf("Unable to save token: %v", err)
+	}
+
+	loaded, err := store.Load(ctx, "key")
+	if err != nil {
+		t.Fatalf("Unable to load token: %v", err)
+	}
+	if *loaded != *token {
+		t.Fatalf("Loaded token %+v does not match saved token %+v", loaded, token)
+	}
+
+	if err := store.Invalidate(ctx, "key"); err != nil {
+		t.Fatalf("Unable to invalidate token: %v", err)
+	}
+	if _, err := store.Load(ctx, "key"); err != ErrTokenNotFound {
+		t.Fatalf("Expected ErrTokenNotFound after invalidate, got: %v", err)
+	}
+	if err := store.Invalidate(ctx, "key"); err != nil {
+		t.Fatalf("Invalidating a missing token should succeed: %v", err)
+	}
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	testTokenStore(t, NewMemoryTokenStore())
+}
+
+func TestFileTokenStore(t *testing.T) {
+	store, err := NewFileTokenStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unable to create file token store: %v", err)
+	}
+	testTokenStore(t, store)
+
+	if err := store.Save(context.Background(), "key", &Token{AccessToken: "secret"}); err != nil {
+		t.Fatalf("Unable to save token: %v", err)
+	}
+	info, err := os.Stat(store.path("key"))
+	if err != nil {
+		t.Fatalf("Token file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Token file must only be readable by the owner, got %v", info.Mode().Perm())
+	}
+}
+
+func TestSharedSession(t *testing.T) {
+	fake := newFakeForce(t)
+	store := NewMemoryTokenStore()
+	opts := []Option{
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithTokenStore(store, ""),
+	}
+
+	first, err := New(opts...)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+	second, err := New(opts...)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	if fake.tokenRequests != 1 {
+		t.Fatalf("Expected the second client to reuse the stored session, got %v logins", fake.tokenRequests)
+	}
+	if first.GetAccessToken() != second.GetAccessToken() {
+		t.Fatalf("Expected a shared session, got %v and %v", first.GetAccessToken(), second.GetAccessToken())
+	}
+
+	// When the shared session expires, the first client renews it and the second picks up the result.
+	var calls int32
+	handleSession(fake, "/data", "token-1", &calls)
+	if err := first.Get("/data", nil, &map[string]interface{}{}); err != nil {
+		t.Fatalf("Expected the session to be renewed: %v", err)
+	}
+	if err := second.Get("/data", nil, &map[string]interface{}{}); err != nil {
+		t.Fatalf("Expected the renewed session to be picked up: %v", err)
+	}
+	if fake.tokenRequests != 2 || second.GetAccessToken() != "token-2" {
+		t.Fatalf("Expected one renewal shared through the store, got %v logins and token %v",
+			fake.tokenRequests, second.GetAccessToken())
+	}
+}
+
+func TestSessionSavedOnLogin(t *testing.T) {
+	fake := newFakeForce(t)
+	store := NewMemoryTokenStore()
+
+	// A session from the web server flow is shared like any other.
+	flow := NewWebServerFlow(testClientId, testClientSecret, "https://portal.example.com/callback",
+		WithLoginURL(fake.URL), WithTokenStore(store, ""))
+	forceApi, err := flow.Exchange(context.Background(), "the-code", "verifier")
+	if err != nil {
+		t.Fatalf("Unable to exchange code: %v", err)
+	}
+	stored, err := store.Load(context.Background(), forceApi.oauth.storeKey)
+	if err != nil || stored.AccessToken != forceApi.GetAccessToken() {
+		t.Fatalf("Expected the exchanged session to be saved, got %+v %v", stored, err)
+	}
+
+	// So is a session refreshed explicitly.
+	if err := forceApi.RefreshToken(); err != nil {
+		t.Fatalf("Unable to refresh token: %v", err)
+	}
+	stored, err = store.Load(context.Background(), forceApi.oauth.storeKey)
+	if err != nil || stored.AccessToken != forceApi.GetAccessToken() || stored.AccessToken == "token-1" {
+		t.Fatalf("Expected the refreshed session to be saved, got %+v %v", stored, err)
+	}
+}
+
+func TestTokenStoreKeyPerUser(t *testing.T) {
+	fake := newFakeForce(t)
+	store := NewMemoryTokenStore()
+	newClient := func(refreshToken string) *ForceApi {
+		forceApi, err := New(
+			WithLoginURL(fake.URL),
+			WithRefreshToken(testClientId, testClientSecret, refreshToken),
+			WithTokenStore(store, ""),
+		)
+		if err != nil {
+			t.Fatalf("Unable to create force api: %v", err)
+		}
+		return forceApi
+	}
+
+	first := newClient("refresh-a")
+	second := newClient("refresh-b")
+	if first.oauth.storeKey == second.oauth.storeKey || fake.tokenRequests != 2 {
+		t.Fatalf("Expected a session per refresh token, got key %v and %v logins", first.oauth.storeKey, fake.tokenRequests)
+	}
+
+	// A session of another user stored under the same key is not adopted on renewal.
+	store.Save(context.Background(), first.oauth.storeKey, &Token{AccessToken: "other", Id: "other-user"})
+	var calls int32
+	handleSession(fake, "/data", first.GetAccessToken(), &calls)
+	if err := first.Get("/data", nil, &map[string]interface{}{}); err != nil {
+		t.Fatalf("Expected the session to be renewed: %v", err)
+	}
+	if first.GetAccessToken() == "other" || fake.tokenRequests != 3 {
+		t.Fatalf("Expected a new login instead of the session of another user, got %v", first.GetAccessToken())
+	}
+}
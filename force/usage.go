@@ -0,0 +1,212 @@
+package force
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const limitInfoHeader string = "Sforce-Limit-Info"
+
+// ErrAPIUsageThrottled is returned instead of sending a request while the org's API usage
+// is above the threshold of an APIUsageThrottle without a delay, apart from the probe
+// requests that refresh the usage.
+var ErrAPIUsageThrottled = errors.New("api usage is above the throttle threshold")
+
+// APIUsage is the number of API requests made by the org in the last 24 hours and its
+// allocation, as reported in the Sforce-Limit-Info header of REST responses.
+type APIUsage struct {
+	Used int
+	Max  int
+}
+
+// PercentUsed returns the share of the allocation used so far, from 0 to 100.
+func (usage APIUsage) PercentUsed() float64 {
+	if usage.Max <= 0 {
+		return 0
+	}
+
+	return float64(usage.Used) * 100 / float64(usage.Max)
+}
+
+// ParseAPIUsage reads the api-usage entry of the Sforce-Limit-Info header, e.g.
+// "api-usage=25/15000".
+func ParseAPIUsage(header http.Header) (*APIUsage, bool) {
+	for _, entry := range strings.Split(header.Get(limitInfoHeader), ",") {
+		name, value := splitPair(strings.TrimSpace(entry), "=")
+		if name != "api-usage" {
+			continue
+		}
+
+		used, max := splitPair(value, "/")
+		usage := &APIUsage{}
+		var err error
+		if usage.Used, err = strconv.Atoi(used); err != nil {
+			return nil, false
+		}
+		if usage.Max, err = strconv.Atoi(max); err != nil {
+			return nil, false
+		}
+
+		return usage, true
+	}
+
+	return nil, false
+}
+
+func splitPair(s, sep string) (string, string) {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return s, ""
+	}
+
+	return s[:i], s[i+len(sep):]
+}
+
+// WithAPIUsageThreshold calls fn when the API usage reported by Salesforce reaches percent
+// of the org's allocation. fn is called once each time usage crosses the threshold, from
+// the goroutine that made the request, and must not block.
+func WithAPIUsageThreshold(percent float64, fn func(usage APIUsage)) Option {
+	return func(o *options) {
+		o.usageThreshold = percent
+		o.onUsageThreshold = fn
+	}
+}
+
+// APIUsageThrottle slows down or stops REST requests while the org is close to its daily
+// API request allocation, to leave room for other integrations.
+type APIUsageThrottle struct {
+	// Threshold is the percentage of the allocation from which requests are throttled.
+	Threshold float64
+
+	// Delay is waited before each request while throttled. When zero, requests fail with
+	// ErrAPIUsageThrottled instead.
+	Delay time.Duration
+
+	// ProbeInterval is how often a request is let through while requests fail, so that
+	// its response tells whether usage has dropped again. One minute when not set.
+	ProbeInterval time.Duration
+}
+
+func (throttle *APIUsageThrottle) probeInterval() time.Duration {
+	if throttle.ProbeInterval <= 0 {
+		return time.Minute
+	}
+
+	return throttle.ProbeInterval
+}
+
+// WithAPIUsageThrottle throttles REST requests according to throttle.
+func WithAPIUsageThrottle(throttle *APIUsageThrottle) Option {
+	return func(o *options) {
+		o.usageThrottle = throttle
+	}
+}
+
+// APIUsage returns the API usage reported by the latest REST response. It returns false
+// until a response reported the usage.
+func (forceApi *ForceApi) APIUsage() (APIUsage, bool) {
+	return forceApi.usage.latest()
+}
+
+// usageTracker keeps the latest API usage reported by Salesforce.
+type usageTracker struct {
+	threshold   float64
+	onThreshold func(usage APIUsage)
+	throttle    *APIUsageThrottle
+
+	mu    sync.Mutex
+	usage *APIUsage
+	above bool
+	// checked is when the usage was last reported or a request last let through to
+	// report it.
+	checked time.Time
+}
+
+func newUsageTracker(o *options) *usageTracker {
+	return &usageTracker{
+		threshold:   o.usageThreshold,
+		onThreshold: o.onUsageThreshold,
+		throttle:    o.usageThrottle,
+	}
+}
+
+func (tracker *usageTracker) latest() (APIUsage, bool) {
+	if tracker == nil {
+		return APIUsage{}, false
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if tracker.usage == nil {
+		return APIUsage{}, false
+	}
+
+	return *tracker.usage, true
+}
+
+// record updates the usage from the headers of a response.
+func (tracker *usageTracker) record(header http.Header) {
+	if tracker == nil {
+		return
+	}
+
+	usage, ok := ParseAPIUsage(header)
+	if !ok {
+		return
+	}
+
+	tracker.mu.Lock()
+	tracker.usage = usage
+	tracker.checked = time.Now()
+	crossed := false
+	if tracker.onThreshold != nil {
+		above := usage.PercentUsed() >= tracker.threshold
+		crossed = above && !tracker.above
+		tracker.above = above
+	}
+	tracker.mu.Unlock()
+
+	if crossed {
+		tracker.onThreshold(*usage)
+	}
+}
+
+// wait applies the throttle before a request is sent.
+func (tracker *usageTracker) wait(ctx context.Context) error {
+	if tracker == nil || tracker.throttle == nil {
+		return nil
+	}
+
+	usage, ok := tracker.latest()
+	if !ok || usage.PercentUsed() < tracker.throttle.Threshold {
+		return nil
+	}
+	if tracker.throttle.Delay > 0 {
+		return sleepContext(ctx, tracker.throttle.Delay)
+	}
+	if !tracker.probe() {
+		return ErrAPIUsageThrottled
+	}
+
+	return nil
+}
+
+// probe reports whether a request may be sent while requests fail, so that the usage
+// is refreshed at least once every probe interval.
+func (tracker *usageTracker) probe() bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if time.Since(tracker.checked) < tracker.throttle.probeInterval() {
+		return false
+	}
+	tracker.checked = time.Now()
+
+	return true
+}
@@ -0,0 +1,110 @@
+package force
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseAPIUsage(t *testing.T) {
+	header := http.Header{}
+	header.Set(limitInfoHeader, "api-usage=25/15000, per-app-api-usage=17/250(appName=sample-app)")
+
+	usage, ok := ParseAPIUsage(header)
+	if !ok || usage.Used != 25 || usage.Max != 15000 {
+		t.Fatalf("Unexpected api usage: %+v", usage)
+	}
+
+	for _, value := range []string{"", "api-usage=25", "per-app-api-usage=17/250"} {
+		header.Set(limitInfoHeader, value)
+		if usage, ok := ParseAPIUsage(header); ok {
+			t.Fatalf("Expected no api usage for %q, got %+v", value, usage)
+		}
+	}
+}
+
+func TestAPIUsageThreshold(t *testing.T) {
+	fake := newFakeForce(t)
+	used := int32(0)
+	fake.mux.HandleFunc("/services/data/"+testVersion+"/limits", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(limitInfoHeader, fmt.Sprintf("api-usage=%d/100", atomic.LoadInt32(&used)))
+		w.Write([]byte(`{}`))
+	})
+
+	var crossings []APIUsage
+	forceApi, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithAPIUsageThreshold(90, func(usage APIUsage) { crossings = append(crossings, usage) }),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+	if _, ok := forceApi.APIUsage(); ok {
+		t.Fatal("Expected no api usage before a response reported it")
+	}
+
+	for _, n := range []int32{50, 90, 95, 40, 91} {
+		atomic.StoreInt32(&used, n)
+		if err := forceApi.Get("/services/data/"+testVersion+"/limits", nil, &map[string]interface{}{}); err != nil {
+			t.Fatalf("Unable to get limits: %v", err)
+		}
+	}
+
+	usage, ok := forceApi.APIUsage()
+	if !ok || usage.Used != 91 || usage.Max != 100 {
+		t.Fatalf("Unexpected latest api usage: %+v", usage)
+	}
+	if len(crossings) != 2 || crossings[0].Used != 90 || crossings[1].Used != 91 {
+		t.Fatalf("Expected the threshold to fire each time it was crossed, got %+v", crossings)
+	}
+}
+
+func TestAPIUsageThrottle(t *testing.T) {
+	fake := newFakeForce(t)
+	requests := int32(0)
+	fake.mux.HandleFunc("/services/data/"+testVersion+"/limits", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set(limitInfoHeader, "api-usage=99/100")
+		} else {
+			w.Header().Set(limitInfoHeader, "api-usage=50/100")
+		}
+		w.Write([]byte(`{}`))
+	})
+
+	forceApi, err := New(
+		WithAPIVersion(testVersion),
+		WithLoginURL(fake.URL),
+		WithPasswordCredentials(testClientId, testClientSecret, testUserName, testPassword, testSecurityToken),
+		WithAPIUsageThrottle(&APIUsageThrottle{Threshold: 95, ProbeInterval: 50 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	out := map[string]interface{}{}
+	if err := forceApi.Get("/services/data/"+testVersion+"/limits", nil, &out); err != nil {
+		t.Fatalf("Unable to get limits: %v", err)
+	}
+	if err := forceApi.Get("/services/data/"+testVersion+"/limits", nil, &out); err != ErrAPIUsageThrottled {
+		t.Fatalf("Expected the request to be throttled, got %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("Expected the throttled request not to be sent, got %v requests", requests)
+	}
+
+	// Once the probe interval has passed, a request is let through and its response lifts
+	// the throttle.
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := forceApi.Get("/services/data/"+testVersion+"/limits", nil, &out); err != nil {
+			t.Fatalf("Expected the throttle to be lifted, got %v", err)
+		}
+	}
+	if atomic.LoadInt32(&requests) != 4 {
+		t.Fatalf("Expected the requests to be sent, got %v requests", requests)
+	}
+}
@@ -0,0 +1,295 @@
+package force
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	authorizeURL string = "/services/oauth2/authorize"
+
+	grantTypeAuthorizationCode string = "authorization_code"
+	codeChallengeMethod        string = "S256"
+
+	// How long a user has to complete the login once it was started.
+	authorizationLifetime = 10 * time.Minute
+
+	// How many logins may be pending at once, so that unauthenticated requests to the
+	// login handler cannot grow memory without bound.
+	maxPendingAuthorizations = 10000
+
+	stateCookieName string = "force_oauth_state"
+)
+
+// ErrInvalidState is returned by the callback handler when the state parameter does not
+// belong to a login started by the same WebServerFlow, or has expired.
+var ErrInvalidState = errors.New("invalid or expired OAuth state")
+
+// ErrTooManyPendingLogins is returned when starting a login while too many logins are
+// pending; it clears up as they complete or expire.
+var ErrTooManyPendingLogins = errors.New("too many pending OAuth logins")
+
+// PKCE holds a proof key for code exchange, see RFC 7636.
+type PKCE struct {
+	Verifier  string
+	Challenge string
+	Method    string
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge.
+func NewPKCE() (*PKCE, error) {
+	verifier, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	hashed := sha256.Sum256([]byte(verifier))
+
+	return &PKCE{
+		Verifier:  verifier,
+		Challenge: base64.RawURLEncoding.EncodeToString(hashed[:]),
+		Method:    codeChallengeMethod,
+	}, nil
+}
+
+// NewState returns a random value for the state parameter of the authorize request.
+func NewState() (string, error) {
+	return randomToken(24)
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// WebServerFlow implements the OAuth 2.0 web server flow with PKCE, for applications
+// where each user connects their own org. Every successful callback yields a ForceApi
+// bound to that user's access and refresh token.
+type WebServerFlow struct {
+	ClientId     string
+	ClientSecret string
+	RedirectURI  string
+
+	// Scopes requested from the user, e.g. "api" and "refresh_token". Salesforce uses the
+	// scopes of the connected app when empty.
+	Scopes []string
+
+	opts    []Option
+	options *options
+
+	mu      sync.Mutex
+	pending map[string]*pendingAuthorization
+}
+
+type pendingAuthorization struct {
+	verifier string
+	expires  time.Time
+
+	// Logins started by LoginHandler must come back from the same browser.
+	cookie bool
+}
+
+// NewWebServerFlow creates a WebServerFlow for the connected app. The options configure
+// the login URL and the ForceApi instances created from each callback.
+func NewWebServerFlow(clientId, clientSecret, redirectURI string, opts ...Option) *WebServerFlow {
+	return &WebServerFlow{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		RedirectURI:  redirectURI,
+		opts:         opts,
+		options:      newOptions(opts),
+		pending:      make(map[string]*pendingAuthorization),
+	}
+}
+
+// AuthCodeURL returns the authorize URL the user is sent to.
+func (flow *WebServerFlow) AuthCodeURL(state string, pkce *PKCE) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {flow.ClientId},
+		"redirect_uri":          {flow.RedirectURI},
+		"state":                 {state},
+		"code_challenge":        {pkce.Challenge},
+		"code_challenge_method": {pkce.Method},
+	}
+	if len(flow.Scopes) != 0 {
+		params.Set("scope", strings.Join(flow.Scopes, " "))
+	}
+
+	return flow.options.loginURI + authorizeURL + "?" + params.Encode()
+}
+
+// Begin starts a login and returns the authorize URL along with its state. The state is
+// remembered until the callback comes back or it expires. It returns
+// ErrTooManyPendingLogins while too many logins are pending.
+func (flow *WebServerFlow) Begin() (authURL, state string, err error) {
+	return flow.begin(false)
+}
+
+func (flow *WebServerFlow) begin(cookie bool) (string, string, error) {
+	state, err := NewState()
+	if err != nil {
+		return "", "", err
+	}
+
+	pkce, err := NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	flow.mu.Lock()
+	defer flow.mu.Unlock()
+
+	now := time.Now()
+	for key, pending := range flow.pending {
+		if now.After(pending.expires) {
+			delete(flow.pending, key)
+		}
+	}
+	if len(flow.pending) >= maxPendingAuthorizations {
+		return "", "", ErrTooManyPendingLogins
+	}
+	flow.pending[state] = &pendingAuthorization{
+		verifier: pkce.Verifier,
+		expires:  now.Add(authorizationLifetime),
+		cookie:   cookie,
+	}
+
+	return flow.AuthCodeURL(state, pkce), state, nil
+}
+
+// claim removes and returns the pending login for the state of a callback. A login
+// started by LoginHandler is only claimed by a request carrying its state cookie, so that
+// a forged callback does not burn the state of the user's own.
+func (flow *WebServerFlow) claim(state string, r *http.Request) (*pendingAuthorization, bool) {
+	flow.mu.Lock()
+	defer flow.mu.Unlock()
+
+	pending, ok := flow.pending[state]
+	if !ok {
+		return nil, false
+	}
+	if pending.cookie {
+		cookie, err := r.Cookie(stateCookieName)
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+			return nil, false
+		}
+	}
+	delete(flow.pending, state)
+
+	if time.Now().After(pending.expires) {
+		return nil, false
+	}
+
+	return pending, true
+}
+
+// Exchange trades an authorization code for a session and returns a ForceApi bound to it.
+// The session is renewed with the refresh token when one was granted.
+func (flow *WebServerFlow) Exchange(ctx context.Context, code, verifier string) (*ForceApi, error) {
+	opts := append([]Option{}, flow.opts...)
+	o := newOptions(append(opts, WithRefreshToken(flow.ClientId, flow.ClientSecret, "")))
+
+	forceApi, err := newForceApi(o)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := url.Values{
+		"grant_type":    {grantTypeAuthorizationCode},
+		"code":          {code},
+		"client_id":     {flow.ClientId},
+		"client_secret": {flow.ClientSecret},
+		"redirect_uri":  {flow.RedirectURI},
+		"code_verifier": {verifier},
+	}
+	if err := forceApi.oauth.AuthenticateWithPayloadContext(ctx, payload); err != nil {
+		return nil, err
+	}
+
+	if len(forceApi.oauth.refreshToken) == 0 {
+		forceApi.oauth.flow = accessTokenFlow
+	}
+	// The user is only known once the code has been exchanged.
+	if len(o.tokenStoreKey) == 0 {
+		forceApi.oauth.storeKey = forceApi.oauth.defaultTokenStoreKey()
+	}
+	forceApi.oauth.saveSession(ctx)
+
+	return initAPIResources(ctx, forceApi)
+}
+
+// LoginHandler redirects the user to the authorize URL. The state is also bound to the
+// user's browser with a cookie, which CallbackHandler checks.
+func (flow *WebServerFlow) LoginHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authURL, state, err := flow.begin(true)
+		if errors.Is(err, ErrTooManyPendingLogins) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     stateCookieName,
+			Value:    state,
+			Path:     "/",
+			MaxAge:   int(authorizationLifetime / time.Second),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// CallbackHandler serves the redirect URI. It validates the state, exchanges the code and
+// passes the resulting ForceApi to onSuccess. Any failure, including the user denying
+// access, is passed to onError.
+func (flow *WebServerFlow) CallbackHandler(onSuccess func(http.ResponseWriter, *http.Request, *ForceApi),
+	onError func(http.ResponseWriter, *http.Request, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		state := query.Get("state")
+		pending, ok := flow.claim(state, r)
+		if !ok {
+			onError(w, r, ErrInvalidState)
+			return
+		}
+		if pending.cookie {
+			http.SetCookie(w, &http.Cookie{Name: stateCookieName, Path: "/", MaxAge: -1})
+		}
+
+		if len(query.Get("error")) != 0 {
+			onError(w, r, &APIError{
+				ErrorName:        query.Get("error"),
+				ErrorDescription: query.Get("error_description"),
+			})
+			return
+		}
+
+		forceApi, err := flow.Exchange(r.Context(), query.Get("code"), pending.verifier)
+		if err != nil {
+			onError(w, r, err)
+			return
+		}
+
+		onSuccess(w, r, forceApi)
+	})
+}
@@ -0,0 +1,139 @@
+package force
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestWebServerFlow(t *testing.T) {
+	fake := newFakeForce(t)
+	flow := NewWebServerFlow(testClientId, testClientSecret, "https://portal.example.com/callback", WithLoginURL(fake.URL))
+	flow.Scopes = []string{"api", "refresh_token"}
+
+	// Start the login.
+	login := httptest.NewRecorder()
+	flow.LoginHandler().ServeHTTP(login, httptest.NewRequest("GET", "/login", nil))
+	if login.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect, got %v", login.Code)
+	}
+
+	authURL, err := url.Parse(login.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Invalid authorize url: %v", err)
+	}
+	authParams := authURL.Query()
+	if authURL.Path != authorizeURL || authParams.Get("client_id") != testClientId ||
+		authParams.Get("code_challenge_method") != codeChallengeMethod || authParams.Get("scope") != "api refresh_token" {
+		t.Fatalf("Unexpected authorize url: %v", authURL)
+	}
+
+	fake.token = func(w http.ResponseWriter, r *http.Request) {
+		hashed := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("grant_type") != grantTypeAuthorizationCode || r.FormValue("code") != "the-code" ||
+			base64.RawURLEncoding.EncodeToString(hashed[:]) != authParams.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"invalid code verifier"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"user-token","refresh_token":"user-refresh","instance_url":"%s"}`, fake.URL)
+	}
+
+	// Come back from the authorize page with the same browser.
+	callback := httptest.NewRequest("GET", "/callback?code=the-code&state="+url.QueryEscape(authParams.Get("state")), nil)
+	for _, cookie := range login.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+
+	var forceApi *ForceApi
+	handler := flow.CallbackHandler(func(w http.ResponseWriter, r *http.Request, api *ForceApi) {
+		forceApi = api
+	}, func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Fatalf("Unexpected callback error: %v", err)
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), callback)
+
+	if forceApi == nil || forceApi.GetAccessToken() != "user-token" {
+		t.Fatalf("Expected a ForceApi bound to the user's session, got %+v", forceApi)
+	}
+	if forceApi.oauth.refreshToken != "user-refresh" || forceApi.oauth.flow != refreshTokenFlow {
+		t.Fatal("Expected the session to be renewable with the refresh token")
+	}
+
+	// The state can only be used once.
+	var callbackErr error
+	flow.CallbackHandler(func(w http.ResponseWriter, r *http.Request, api *ForceApi) {
+		t.Fatal("A replayed state must not succeed")
+	}, func(w http.ResponseWriter, r *http.Request, err error) {
+		callbackErr = err
+	}).ServeHTTP(httptest.NewRecorder(), callback)
+	if !errors.Is(callbackErr, ErrInvalidState) {
+		t.Fatalf("Expected ErrInvalidState, got: %v", callbackErr)
+	}
+}
+
+func TestWebServerFlowStateBoundToBrowser(t *testing.T) {
+	flow := NewWebServerFlow(testClientId, testClientSecret, "https://portal.example.com/callback")
+
+	login := httptest.NewRecorder()
+	flow.LoginHandler().ServeHTTP(login, httptest.NewRequest("GET", "/login", nil))
+	authURL, _ := url.Parse(login.Header().Get("Location"))
+
+	// Same state, but no cookie: someone else's browser.
+	callback := httptest.NewRequest("GET", "/callback?code=the-code&state="+url.QueryEscape(authURL.Query().Get("state")), nil)
+
+	var callbackErr error
+	flow.CallbackHandler(func(w http.ResponseWriter, r *http.Request, api *ForceApi) {
+		t.Fatal("A callback without the state cookie must not succeed")
+	}, func(w http.ResponseWriter, r *http.Request, err error) {
+		callbackErr = err
+	}).ServeHTTP(httptest.NewRecorder(), callback)
+	if !errors.Is(callbackErr, ErrInvalidState) {
+		t.Fatalf("Expected ErrInvalidState, got: %v", callbackErr)
+	}
+
+	// The rejected callback must not burn the state for the browser that owns it.
+	for _, cookie := range login.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	if _, ok := flow.claim(authURL.Query().Get("state"), callback); !ok {
+		t.Fatal("Expected the state to still be claimable with its cookie")
+	}
+}
+
+func TestWebServerFlowPendingLimit(t *testing.T) {
+	flow := NewWebServerFlow(testClientId, testClientSecret, "https://portal.example.com/callback")
+	for i := 0; i < maxPendingAuthorizations; i++ {
+		if _, _, err := flow.begin(true); err != nil {
+			t.Fatalf("Unable to begin login %v: %v", i, err)
+		}
+	}
+
+	login := httptest.NewRecorder()
+	flow.LoginHandler().ServeHTTP(login, httptest.NewRequest("GET", "/login", nil))
+	if login.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected logins to be refused once the limit is reached, got %v", login.Code)
+	}
+}
+
+func TestNewPKCE(t *testing.T) {
+	pkce, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("Unable to create PKCE: %v", err)
+	}
+
+	// RFC 7636 requires a verifier between 43 and 128 characters.
+	if len(pkce.Verifier) < 43 || len(pkce.Verifier) > 128 {
+		t.Fatalf("Unexpected verifier length: %v", len(pkce.Verifier))
+	}
+
+	hashed := sha256.Sum256([]byte(pkce.Verifier))
+	if pkce.Challenge != base64.RawURLEncoding.EncodeToString(hashed[:]) || pkce.Method != "S256" {
+		t.Fatalf("Unexpected challenge: %+v", pkce)
+	}
+}
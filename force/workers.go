@@ -0,0 +1,135 @@
+package force
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// OverflowPolicy decides what happens to a streaming message that arrives while the queue
+// of its worker is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue. It holds up the streaming loop, and with
+	// it the long poll, until the handlers catch up.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued message to make room.
+	OverflowDropOldest
+	// OverflowError drops the arriving message.
+	OverflowError
+)
+
+// StreamingWorkers configures a pool of goroutines that handle streaming messages, so
+// that slow handlers do not hold up the streaming loop. The messages of one channel are
+// always handled by the same worker, in the order they were delivered; the messages of
+// different channels are handled concurrently.
+type StreamingWorkers struct {
+	// Workers is the number of goroutines, 1 when not set.
+	Workers int
+	// QueueSize is the number of messages queued for each worker, 100 when not set.
+	QueueSize int
+	Overflow  OverflowPolicy
+}
+
+// DroppedMessageError is reported to the streaming error handler for a message dropped
+// because the queue of its worker was full. The client then subscribes to the channel
+// again to have the dropped message, and those handled since, delivered again; the replay
+// position of the channel stays before the message until it has been handled.
+type DroppedMessageError struct {
+	Message *Message
+}
+
+func (err *DroppedMessageError) Error() string {
+	return fmt.Sprintf("streaming queue is full, dropped message %v on %v", err.Message.ReplayID, err.Message.Channel)
+}
+
+// WithStreamingWorkers handles streaming messages on a pool of goroutines rather than on
+// the streaming loop. The replay id of a message is saved once every subscription has
+// handled it.
+func WithStreamingWorkers(workers StreamingWorkers) Option {
+	return func(o *options) {
+		o.streamWorkers = &workers
+	}
+}
+
+// streamWorkers queues the messages of each channel for the worker the channel hashes to.
+type streamWorkers struct {
+	stream   *StreamsForce
+	overflow OverflowPolicy
+	queues   []chan *Message
+	wg       sync.WaitGroup
+}
+
+func newStreamWorkers(stream *StreamsForce, config StreamingWorkers) *streamWorkers {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+
+	workers := &streamWorkers{
+		stream:   stream,
+		overflow: config.Overflow,
+		queues:   make([]chan *Message, config.Workers),
+	}
+	for i := range workers.queues {
+		queue := make(chan *Message, config.QueueSize)
+		workers.queues[i] = queue
+
+		workers.wg.Add(1)
+		go func() {
+			defer workers.wg.Done()
+			for msg := range queue {
+				stream.handle(msg)
+			}
+		}()
+	}
+
+	return workers
+}
+
+// enqueue queues msg for the worker of its channel, applying the overflow policy when
+// the queue is full. It is only called from the streaming loop.
+func (workers *streamWorkers) enqueue(msg *Message) {
+	hash := fnv.New32a()
+	hash.Write([]byte(msg.Channel))
+	queue := workers.queues[hash.Sum32()%uint32(len(workers.queues))]
+
+	switch workers.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- msg:
+				return
+			default:
+			}
+
+			select {
+			case dropped := <-queue:
+				workers.stream.dropped(dropped, &DroppedMessageError{Message: dropped})
+			default:
+			}
+		}
+	case OverflowError:
+		select {
+		case queue <- msg:
+		default:
+			workers.stream.dropped(msg, &DroppedMessageError{Message: msg})
+		}
+	default:
+		select {
+		case queue <- msg:
+		case <-workers.stream.ctx.Done():
+		}
+	}
+}
+
+// stop waits for the queued messages to be handled and the workers to exit.
+func (workers *streamWorkers) stop() {
+	for _, queue := range workers.queues {
+		close(queue)
+	}
+	workers.wg.Wait()
+}
@@ -0,0 +1,322 @@
+package force
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedHandler records the replay ids it handles, holding each message until released.
+type gatedHandler struct {
+	started chan int64
+	release chan struct{}
+
+	mu      sync.Mutex
+	handled []int64
+}
+
+func newGatedHandler() *gatedHandler {
+	return &gatedHandler{started: make(chan int64, 100), release: make(chan struct{})}
+}
+
+func (handler *gatedHandler) handle(msg *Message) {
+	handler.started <- msg.ReplayID
+	<-handler.release
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	handler.handled = append(handler.handled, msg.ReplayID)
+}
+
+func (handler *gatedHandler) waitStarted(t *testing.T, replayID int64) {
+	t.Helper()
+
+	select {
+	case started := <-handler.started:
+		if started != replayID {
+			t.Fatalf("Expected message %v to be handled, got %v", replayID, started)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected message %v to be handled", replayID)
+	}
+}
+
+func connectTestWorkers(t *testing.T, cometd *fakeCometd, workers StreamingWorkers,
+	onError func(error)) *ForceApi {
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.streamWorkers = &workers
+	forceApi.onStreamError = onError
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+
+	return forceApi
+}
+
+func TestStreamingWorkersDoNotStallLongPoll(t *testing.T) {
+	cometd := newFakeCometd(t)
+	store := NewMemoryReplayStore()
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.streamWorkers = &StreamingWorkers{}
+	forceApi.replayStore = store
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer forceApi.DisconnectStreamingAPI()
+
+	handler := newGatedHandler()
+	if _, err := forceApi.SubscribeFunc("Event", "Order__e", handler.handle); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	publishOrder(cometd, 1)
+	handler.waitStarted(t, 1)
+
+	connects := len(cometd.sent(metaConnect))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(cometd.sent(metaConnect)) < connects+3 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the streaming loop to keep polling while the handler runs")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := store.Load(context.Background(), "/event/Order__e"); err != ErrReplayIDNotFound {
+		t.Fatalf("Expected the replay id to be saved only after the handler finished, got %v", err)
+	}
+	close(handler.release)
+
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		if replayID, _ := store.Load(context.Background(), "/event/Order__e"); replayID == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the replay id to be saved once the handler finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamingWorkersOrderPerChannel(t *testing.T) {
+	cometd := newFakeCometd(t)
+	forceApi := connectTestWorkers(t, cometd, StreamingWorkers{Workers: 4, QueueSize: 10}, nil)
+
+	var mu sync.Mutex
+	handled := make(map[string][]int64)
+	done := make(chan struct{}, 100)
+	topics := []string{"Order__e", "Invoice__e", "Payment__e"}
+	for _, topic := range topics {
+		if _, err := forceApi.SubscribeFunc("Event", topic, func(msg *Message) {
+			// Make later messages overtake earlier ones if ordering is not kept.
+			time.Sleep(time.Duration(msg.ReplayID%3) * time.Millisecond)
+
+			mu.Lock()
+			handled[msg.Channel] = append(handled[msg.Channel], msg.ReplayID)
+			mu.Unlock()
+			done <- struct{}{}
+		}); err != nil {
+			t.Fatalf("Unable to subscribe: %v", err)
+		}
+	}
+
+	for replayID := int64(1); replayID <= 30; replayID++ {
+		topic := topics[replayID%3]
+		cometd.publish("/event/"+topic, fmt.Sprintf(`{"event":{"replayId":%d}}`, replayID))
+	}
+	for i := 0; i < 30; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected every message to be handled")
+		}
+	}
+
+	if err := forceApi.DisconnectStreamingAPI(); err != nil {
+		t.Fatalf("Unable to disconnect: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for channel, replayIDs := range handled {
+		for i := 1; i < len(replayIDs); i++ {
+			if replayIDs[i] < replayIDs[i-1] {
+				t.Fatalf("Expected the messages of %v to be handled in order, got %v", channel, replayIDs)
+			}
+		}
+	}
+}
+
+func TestStreamingWorkersOverflow(t *testing.T) {
+	tests := []struct {
+		overflow OverflowPolicy
+		handled  []int64
+		dropped  []int64
+		saved    int64
+	}{
+		{OverflowBlock, []int64{1, 2, 3, 4}, nil, 4},
+		{OverflowDropOldest, []int64{1, 4}, []int64{2, 3}, 1},
+		{OverflowError, []int64{1, 2}, []int64{3, 4}, 2},
+	}
+
+	for _, test := range tests {
+		cometd := newFakeCometd(t)
+		store := NewMemoryReplayStore()
+
+		var mu sync.Mutex
+		var dropped []int64
+		forceApi := newTestForceApi(cometd.URL)
+		forceApi.streamWorkers = &StreamingWorkers{QueueSize: 1, Overflow: test.overflow}
+		forceApi.replayStore = store
+		forceApi.onStreamError = func(err error) {
+			var droppedErr *DroppedMessageError
+			if errors.As(err, &droppedErr) {
+				mu.Lock()
+				dropped = append(dropped, droppedErr.Message.ReplayID)
+				mu.Unlock()
+			}
+		}
+		if err := forceApi.ConnectToStreamingAPI(); err != nil {
+			t.Fatalf("Unable to connect: %v", err)
+		}
+
+		handler := newGatedHandler()
+		if _, err := forceApi.SubscribeFunc("Event", "Order__e", handler.handle); err != nil {
+			t.Fatalf("Unable to subscribe: %v", err)
+		}
+
+		// Hold the worker on the first message, then overflow its queue of one.
+		publishOrder(cometd, 1)
+		handler.waitStarted(t, 1)
+		publishOrder(cometd, 2, 3, 4)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			n := len(dropped)
+			mu.Unlock()
+			if n == len(test.dropped) && (len(cometd.events) == 0 || test.overflow == OverflowBlock) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Overflow %v: expected %v dropped messages, got %v", test.overflow, test.dropped, dropped)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		close(handler.release)
+		deadline = time.Now().Add(5 * time.Second)
+		for {
+			handler.mu.Lock()
+			n := len(handler.handled)
+			handler.mu.Unlock()
+			if n == len(test.handled) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Overflow %v: expected %v handled, got %v", test.overflow, test.handled, handler.handled)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		forceApi.DisconnectStreamingAPI()
+
+		if fmt.Sprint(handler.handled) != fmt.Sprint(test.handled) || fmt.Sprint(dropped) != fmt.Sprint(test.dropped) {
+			t.Fatalf("Overflow %v: expected %v handled and %v dropped, got %v and %v",
+				test.overflow, test.handled, test.dropped, handler.handled, dropped)
+		}
+		// The replay position never moves past a dropped message.
+		if saved, _ := store.Load(context.Background(), "/event/Order__e"); saved != test.saved {
+			t.Fatalf("Overflow %v: expected replay id %v to be saved, got %v", test.overflow, test.saved, saved)
+		}
+	}
+}
+
+func TestStreamingWorkersRedeliverDropped(t *testing.T) {
+	cometd := newFakeCometd(t)
+	cometd.retain = true
+	store := NewMemoryReplayStore()
+
+	dropped := make(chan int64, 100)
+	forceApi := newTestForceApi(cometd.URL)
+	forceApi.streamWorkers = &StreamingWorkers{QueueSize: 1, Overflow: OverflowError}
+	forceApi.replayStore = store
+	forceApi.onStreamError = func(err error) {
+		var droppedErr *DroppedMessageError
+		if errors.As(err, &droppedErr) {
+			dropped <- droppedErr.Message.ReplayID
+		}
+	}
+	if err := forceApi.ConnectToStreamingAPI(); err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer forceApi.DisconnectStreamingAPI()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	handled := make(chan int64, 100)
+	if _, err := forceApi.SubscribeFunc("Event", "Order__e", func(msg *Message) {
+		if msg.ReplayID == 1 {
+			close(started)
+			<-release
+		}
+		handled <- msg.ReplayID
+	}, ReplayFrom(ReplayNewEvents)); err != nil {
+		t.Fatalf("Unable to subscribe: %v", err)
+	}
+
+	// Hold the worker on the first message, so that 2 is queued and 3 and 4 are dropped.
+	publishOrder(cometd, 1)
+	<-started
+	publishOrder(cometd, 2, 3, 4)
+	select {
+	case replayID := <-dropped:
+		if replayID != 3 {
+			t.Fatalf("Expected message 3 to be dropped first, got %v", replayID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a message to be dropped")
+	}
+	close(release)
+
+	// The channel is subscribed again from right before the dropped message, which is
+	// delivered again without waiting for a handshake.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(cometd.sent(metaSubscribe)) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the channel to be subscribed again")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if replayID := subscribedReplayID(t, cometd, 1, "/event/Order__e"); replayID != 2 {
+		t.Fatalf("Expected to subscribe again from replay id 2, got %v", replayID)
+	}
+	if handshakes, _ := cometd.stats(); handshakes != 1 {
+		t.Fatalf("Expected no handshake, got %v", handshakes)
+	}
+
+	// Once the dropped messages are handled, the saved replay id moves past them, and on
+	// with the next message.
+	seen := map[int64]bool{}
+	for !seen[3] || !seen[4] {
+		select {
+		case replayID := <-handled:
+			seen[replayID] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected messages 3 and 4 to be delivered again, got %v", seen)
+		}
+	}
+	publishOrder(cometd, 5)
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		saved, _ := store.Load(context.Background(), "/event/Order__e")
+		if saved == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the saved replay id to move past the dropped messages, got %v", saved)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"io"
 )
 
+// minRead is the least room left in the buffer before reading more input.
+const minRead = 512
+
 // A Decoder reads and decodes JSON objects from an input stream.
 type Decoder struct {
 	r    io.Reader
@@ -27,6 +30,12 @@ func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{r: r}
 }
 
+// NewDecoderSize is like NewDecoder but sizes the buffer for a value of size bytes, so
+// that reading an input of known length allocates it once instead of growing it.
+func NewDecoderSize(r io.Reader, size int) *Decoder {
+	return &Decoder{r: r, buf: make([]byte, 0, size+minRead)}
+}
+
 // UseNumber causes the Decoder to unmarshal a number into an interface{} as a
 // Number instead of as a float64.
 func (dec *Decoder) UseNumber() { dec.d.useNumber = true }
@@ -112,7 +121,6 @@ Input:
 		}
 
 		// Make room to read more into the buffer.
-		const minRead = 512
 		if cap(dec.buf)-len(dec.buf) < minRead {
 			newBuf := make([]byte, len(dec.buf), 2*cap(dec.buf)+minRead)
 			copy(newBuf, dec.buf)
@@ -2,8 +2,4 @@ module github.com/dewisuryani/go-force
 
 go 1.15
 
-require (
-	github.com/sirupsen/logrus v1.8.1
-	github.com/ztrue/tracerr v0.3.0
-	golang.org/x/net v0.0.0-20201021035429-f5854403a974
-)
+require golang.org/x/net v0.0.0-20201021035429-f5854403a974
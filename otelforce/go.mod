@@ -0,0 +1,27 @@
+module github.com/dewisuryani/go-force/otelforce
+
+go 1.25.0
+
+require (
+	github.com/dewisuryani/go-force v0.1.0
+	go.opentelemetry.io/otel v1.46.0
+	go.opentelemetry.io/otel/metric v1.46.0
+	go.opentelemetry.io/otel/sdk v1.46.0
+	go.opentelemetry.io/otel/sdk/metric v1.46.0
+	go.opentelemetry.io/otel/trace v1.46.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/go-logr/logr v1.4.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/auto/sdk v1.2.1 // indirect
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+)
+
+// The require above is the release of the root module dependents get, so the root is
+// tagged v0.1.0 before otelforce/v0.1.0. Builds inside this repository use the working
+// tree instead.
+replace github.com/dewisuryani/go-force => ../
@@ -0,0 +1,217 @@
+// Package otelforce instruments go-force with OpenTelemetry.
+//
+// It records a client span and latency metrics for every REST call, OAuth exchange, query
+// page and streaming round trip, along with counters for retries and session renewals and
+// gauges for the org's API usage. It only uses the OpenTelemetry API, so nothing is
+// exported until the application installs a tracer and meter provider.
+//
+//	forceApi, err := force.New(
+//		force.WithPasswordCredentials(clientId, clientSecret, userName, password, securityToken),
+//		otelforce.WithInstrumentation(),
+//	)
+package otelforce
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dewisuryani/go-force/force"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName string = "github.com/dewisuryani/go-force/otelforce"
+
+// Attribute keys set on spans and metrics.
+const (
+	CallKindKey   = attribute.Key("salesforce.call.kind")
+	OperationKey  = attribute.Key("salesforce.operation")
+	SObjectKey    = attribute.Key("salesforce.sobject")
+	AttemptKey    = attribute.Key("salesforce.attempt")
+	ErrorCodeKey  = attribute.Key("salesforce.error_code")
+	MethodKey     = attribute.Key("http.request.method")
+	StatusCodeKey = attribute.Key("http.response.status_code")
+	ServerKey     = attribute.Key("server.address")
+	PathKey       = attribute.Key("url.path")
+)
+
+// Option configures the instrumentation.
+type Option func(*config)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+}
+
+// WithTracerProvider records spans with tp instead of the global tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider records metrics with mp instead of the global meter provider.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = mp
+	}
+}
+
+// WithInstrumentation is a force option that adds the interceptor returned by NewInterceptor.
+func WithInstrumentation(opts ...Option) force.Option {
+	return force.WithInterceptors(NewInterceptor(opts...))
+}
+
+type instruments struct {
+	tracer trace.Tracer
+
+	duration metric.Float64Histogram
+	retries  metric.Int64Counter
+	renewals metric.Int64Counter
+	apiUsed  metric.Int64Gauge
+	apiMax   metric.Int64Gauge
+}
+
+// NewInterceptor returns a force interceptor that records spans and metrics for each call.
+func NewInterceptor(opts ...Option) force.Interceptor {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tracerProvider == nil {
+		c.tracerProvider = otel.GetTracerProvider()
+	}
+	if c.meterProvider == nil {
+		c.meterProvider = otel.GetMeterProvider()
+	}
+
+	meter := c.meterProvider.Meter(instrumentationName)
+	inst := &instruments{tracer: c.tracerProvider.Tracer(instrumentationName)}
+
+	// The instruments fall back to no-ops when creating them fails.
+	inst.duration, _ = meter.Float64Histogram("salesforce.client.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of calls to Salesforce."))
+	inst.retries, _ = meter.Int64Counter("salesforce.client.retries",
+		metric.WithDescription("Retried attempts of REST calls."))
+	inst.renewals, _ = meter.Int64Counter("salesforce.client.session_renewals",
+		metric.WithDescription("Logins made to replace an expired session."))
+	inst.apiUsed, _ = meter.Int64Gauge("salesforce.api.usage",
+		metric.WithDescription("API requests made by the org in the last 24 hours."))
+	inst.apiMax, _ = meter.Int64Gauge("salesforce.api.limit",
+		metric.WithDescription("API requests the org is allocated per 24 hours."))
+
+	return inst.intercept
+}
+
+func (inst *instruments) intercept(call *force.Call, next force.Invoker) (*http.Response, error) {
+	req := call.Request
+	ctx := req.Context()
+
+	attrs := []attribute.KeyValue{
+		CallKindKey.String(call.Kind.String()),
+		MethodKey.String(req.Method),
+	}
+	if len(call.Operation) != 0 {
+		attrs = append(attrs, OperationKey.String(call.Operation))
+	}
+	if len(call.SObject) != 0 {
+		attrs = append(attrs, SObjectKey.String(call.SObject))
+	}
+
+	ctx, span := inst.tracer.Start(ctx, spanName(call),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(
+			AttemptKey.Int(call.Attempt),
+			ServerKey.String(req.URL.Hostname()),
+			PathKey.String(req.URL.Path),
+		))
+	defer span.End()
+
+	call.Request = req.WithContext(ctx)
+
+	if call.Attempt > 1 {
+		inst.retries.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+	if call.Kind == force.OAuthCall && call.Operation == "renew" {
+		inst.renewals.Add(ctx, 1)
+	}
+
+	start := time.Now()
+	resp, err := next(call)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		inst.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(attrs...))
+		return resp, err
+	}
+
+	attrs = append(attrs, StatusCodeKey.Int(resp.StatusCode))
+	span.SetAttributes(StatusCodeKey.Int(resp.StatusCode))
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		if code := errorCode(resp); len(code) != 0 {
+			attrs = append(attrs, ErrorCodeKey.String(code))
+			span.SetAttributes(ErrorCodeKey.String(code))
+		}
+		span.SetStatus(codes.Error, strconv.Itoa(resp.StatusCode)+" "+http.StatusText(resp.StatusCode))
+	}
+
+	if usage, ok := force.ParseAPIUsage(resp.Header); ok {
+		inst.apiUsed.Record(ctx, int64(usage.Used))
+		inst.apiMax.Record(ctx, int64(usage.Max))
+	}
+
+	inst.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(attrs...))
+
+	return resp, nil
+}
+
+// spanName names spans after the operation and sObject, e.g. "salesforce insert Account",
+// and after the kind of call when the operation is unknown.
+func spanName(call *force.Call) string {
+	name := "salesforce " + call.Kind.String()
+	if len(call.Operation) != 0 {
+		name = "salesforce " + call.Operation
+	}
+	if len(call.SObject) != 0 {
+		name += " " + call.SObject
+	}
+
+	return name
+}
+
+// errorCode reads the first Salesforce error code of a failed response, leaving the body
+// for the caller to read again.
+func errorCode(resp *http.Response) string {
+	if resp.Body == nil {
+		return ""
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	for _, apiErr := range force.ParseAPIErrors(body) {
+		if len(apiErr.ErrorCode) != 0 {
+			return apiErr.ErrorCode
+		}
+		if len(apiErr.ErrorName) != 0 {
+			return apiErr.ErrorName
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,141 @@
+package otelforce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dewisuryani/go-force/force"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const testVersion string = "v36.0"
+
+type account struct {
+	Name string `force:"Name"`
+}
+
+func (account) APIName() string {
+	return "Account"
+}
+
+func (account) ExternalIdAPIName() string {
+	return ""
+}
+
+func newFakeForce(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/services/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"access_token":"token","instance_url":"%s","id":"%s/id/00D/005"}`, server.URL, server.URL)
+	})
+	mux.HandleFunc("/services/data/"+testVersion, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"sobjects":"/services/data/%s/sobjects"}`, testVersion)
+	})
+	mux.HandleFunc("/services/data/"+testVersion+"/sobjects", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"sobjects":[{"name":"Account","urls":{"sobject":"/services/data/%[1]s/sobjects/Account","rowTemplate":"/services/data/%[1]s/sobjects/Account/{ID}"}}]}`,
+			testVersion)
+	})
+	mux.HandleFunc("/services/data/"+testVersion+"/sobjects/Account", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Sforce-Limit-Info", "api-usage=25/15000")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`[{"message":"Required fields are missing: [Name]","errorCode":"REQUIRED_FIELD_MISSING","fields":["Name"]}]`))
+	})
+
+	return server
+}
+
+func TestInterceptor(t *testing.T) {
+	server := newFakeForce(t)
+
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	forceApi, err := force.New(
+		force.WithAPIVersion(testVersion),
+		force.WithLoginURL(server.URL),
+		force.WithPasswordCredentials("client", "secret", "user", "password", ""),
+		WithInstrumentation(WithTracerProvider(tp), WithMeterProvider(mp)),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	if _, err := forceApi.InsertSObject(account{}); err == nil {
+		t.Fatal("Expected the insert to fail")
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 4 {
+		t.Fatalf("Expected a span for the login, resources, sobjects and insert, got %v", len(ended))
+	}
+	if ended[0].Name() != "salesforce password" {
+		t.Fatalf("Unexpected login span name: %v", ended[0].Name())
+	}
+
+	insert := ended[3]
+	if insert.Name() != "salesforce insert Account" {
+		t.Fatalf("Unexpected insert span name: %v", insert.Name())
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range insert.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs[SObjectKey].AsString() != "Account" || attrs[OperationKey].AsString() != "insert" {
+		t.Fatalf("Unexpected insert span attributes: %v", attrs)
+	}
+	if attrs[StatusCodeKey].AsInt64() != http.StatusBadRequest || attrs[ErrorCodeKey].AsString() != "REQUIRED_FIELD_MISSING" {
+		t.Fatalf("Unexpected insert span attributes: %v", attrs)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Unable to collect metrics: %v", err)
+	}
+
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	if _, ok := metrics["salesforce.client.duration"]; !ok {
+		t.Fatalf("Expected call durations to be recorded, got %v", metrics)
+	}
+	usage, ok := metrics["salesforce.api.usage"].(metricdata.Gauge[int64])
+	if !ok || len(usage.DataPoints) != 1 || usage.DataPoints[0].Value != 25 {
+		t.Fatalf("Expected the api usage to be recorded, got %v", metrics["salesforce.api.usage"])
+	}
+}
+
+func TestInterceptorWithoutProviders(t *testing.T) {
+	server := newFakeForce(t)
+
+	// With the global no-op providers the instrumentation must stay out of the way.
+	forceApi, err := force.New(
+		force.WithAPIVersion(testVersion),
+		force.WithLoginURL(server.URL),
+		force.WithPasswordCredentials("client", "secret", "user", "password", ""),
+		WithInstrumentation(),
+	)
+	if err != nil {
+		t.Fatalf("Unable to create force api: %v", err)
+	}
+
+	_, err = forceApi.InsertSObject(account{})
+	var forceErr *force.Error
+	if !errors.As(err, &forceErr) || !forceErr.HasErrorCode("REQUIRED_FIELD_MISSING") {
+		t.Fatalf("Expected the error body to reach the client, got %v", err)
+	}
+}